@@ -0,0 +1,509 @@
+// Command crdgen writes the CustomResourceDefinitions the controller installs.
+// Every template in the templates directory is a CustomResourceDefinition
+// without schemas. crdgen fills in the schema of each version from the Go
+// type of the kind in the package of that version, and writes the result
+// under the same name to the output directory.
+//
+// Fields are required unless their JSON name has omitempty or they are marked
+// +optional. Doc comments become descriptions. Fields and types take these
+// markers, which follow controller-gen:
+//
+//	+kubebuilder:validation:Pattern=`<regular expression>`
+//	+kubebuilder:validation:Enum=<value>;<value>
+//	+kubebuilder:validation:Minimum=<n>
+//	+kubebuilder:validation:MinLength=<n>
+//	+kubebuilder:validation:MinItems=<n>
+//	+kubebuilder:validation:EmbeddedResource
+//	+kubebuilder:validation:XValidation:rule="<CEL>",message="<text>"
+//	+listType=map|set
+//	+listMapKey=<field>
+//
+// A marker of a list field that starts with items: applies to its items.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+func main() {
+	types := flag.String("types", "pkg/api/icp.ibm.com", "Directory holding a package of API types per version.")
+	templates := flag.String("templates", "resources/crd", "Directory holding the CustomResourceDefinition templates.")
+	out := flag.String("out", "resources", "Directory the CustomResourceDefinitions are written to.")
+	flag.Parse()
+
+	files, err := generate(*types, *templates)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(*out, name), data, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// generate returns the CustomResourceDefinition of every template in
+// templates by file name, with the schemas of the types in types.
+func generate(types, templates string) (map[string][]byte, error) {
+	paths, err := filepath.Glob(filepath.Join(templates, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	packages := map[string]*pkg{}
+	files := map[string][]byte{}
+	for _, path := range paths {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		crd := map[string]interface{}{}
+		if err := yaml.Unmarshal(raw, &crd); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		spec, _ := crd["spec"].(map[string]interface{})
+		names, _ := spec["names"].(map[string]interface{})
+		kind, _ := names["kind"].(string)
+		versions, _ := spec["versions"].([]interface{})
+		for _, v := range versions {
+			version, _ := v.(map[string]interface{})
+			name, _ := version["name"].(string)
+			p, ok := packages[name]
+			if !ok {
+				if p, err = parsePackage(filepath.Join(types, name)); err != nil {
+					return nil, err
+				}
+				packages[name] = p
+			}
+			schema, err := p.root(kind)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", path, name, err)
+			}
+			version["schema"] = map[string]interface{}{"openAPIV3Schema": schema}
+		}
+		data, err := yaml.Marshal(crd)
+		if err != nil {
+			return nil, err
+		}
+		header := fmt.Sprintf("# Code generated by crdgen from %s. DO NOT EDIT.\n", filepath.Base(path))
+		files[filepath.Base(path)] = append([]byte(header), data...)
+	}
+	return files, nil
+}
+
+// schema is a JSON schema as the apiserver takes it.
+type schema map[string]interface{}
+
+// typeDecl is a type declared in a package of API types.
+type typeDecl struct {
+	spec *ast.TypeSpec
+	doc  *ast.CommentGroup
+	file *ast.File
+}
+
+// pkg is a parsed package of API types.
+type pkg struct {
+	dir   string
+	types map[string]typeDecl
+}
+
+func parsePackage(dir string) (*pkg, error) {
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	p := &pkg{dir: dir, types: map[string]typeDecl{}}
+	for _, astPkg := range parsed {
+		for _, file := range astPkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, s := range gen.Specs {
+					ts := s.(*ast.TypeSpec)
+					doc := ts.Doc
+					if doc == nil && len(gen.Specs) == 1 {
+						doc = gen.Doc
+					}
+					p.types[ts.Name.Name] = typeDecl{spec: ts, doc: doc, file: file}
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// root returns the schema of the object of kind. Its metadata is filled in
+// by the apiserver and its spec is checked by the validations of the spec,
+// so none of its fields are required.
+func (p *pkg) root(kind string) (schema, error) {
+	decl, ok := p.types[kind]
+	if !ok {
+		return nil, fmt.Errorf("no type %s in %s", kind, p.dir)
+	}
+	s, err := p.typeSchema(kind, decl)
+	if err != nil {
+		return nil, err
+	}
+	delete(s, "required")
+	return s, nil
+}
+
+// typeSchema returns the schema of the named type, with the markers of its
+// declaration applied.
+func (p *pkg) typeSchema(name string, decl typeDecl) (schema, error) {
+	var s schema
+	var err error
+	if st, ok := decl.spec.Type.(*ast.StructType); ok {
+		s, err = p.structSchema(st, decl.file)
+	} else {
+		s, err = p.exprSchema(decl.spec.Type, decl.file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if err := applyMarkers(s, decl.doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if d := description(decl.doc); d != "" {
+		s["description"] = d
+	}
+	return s, nil
+}
+
+// structSchema returns the schema of an object with the fields of st.
+// Inlined fields add their properties, required fields and validations.
+func (p *pkg) structSchema(st *ast.StructType, file *ast.File) (schema, error) {
+	properties := schema{}
+	var required []string
+	s := schema{"type": "object"}
+	for _, field := range st.Fields.List {
+		name, omitempty, inline := jsonName(field)
+		if name == "-" {
+			continue
+		}
+		fs, err := p.exprSchema(field.Type, file)
+		if err != nil {
+			return nil, err
+		}
+		if inline || (name == "" && len(field.Names) == 0) {
+			props, _ := fs["properties"].(schema)
+			for k, v := range props {
+				properties[k] = v
+			}
+			if req, ok := fs["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			if rules, ok := fs["x-kubernetes-validations"].([]interface{}); ok {
+				addValidations(s, rules)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Names[0].Name
+		}
+		if d := description(field.Doc); d != "" {
+			fs["description"] = d
+		}
+		if err := applyMarkers(fs, field.Doc); err != nil {
+			return nil, fmt.Errorf("field %s: %v", name, err)
+		}
+		properties[name] = fs
+		if !omitempty && !hasMarker(field.Doc, "+optional") {
+			required = append(required, name)
+		}
+	}
+	if len(properties) > 0 {
+		s["properties"] = properties
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s, nil
+}
+
+// exprSchema returns the schema of the type expression e in file.
+func (p *pkg) exprSchema(e ast.Expr, file *ast.File) (schema, error) {
+	switch t := e.(type) {
+	case *ast.StarExpr:
+		return p.exprSchema(t.X, file)
+	case *ast.ArrayType:
+		items, err := p.exprSchema(t.Elt, file)
+		if err != nil {
+			return nil, err
+		}
+		return schema{"type": "array", "items": items}, nil
+	case *ast.MapType:
+		values, err := p.exprSchema(t.Value, file)
+		if err != nil {
+			return nil, err
+		}
+		return schema{"type": "object", "additionalProperties": values}, nil
+	case *ast.Ident:
+		switch t.Name {
+		case "string":
+			return schema{"type": "string"}, nil
+		case "bool":
+			return schema{"type": "boolean"}, nil
+		case "int32", "int64":
+			return schema{"type": "integer", "format": t.Name}, nil
+		case "int":
+			return schema{"type": "integer"}, nil
+		}
+		decl, ok := p.types[t.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s", t.Name)
+		}
+		return p.typeSchema(t.Name, decl)
+	case *ast.SelectorExpr:
+		x, ok := t.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		path := importPath(file, x.Name)
+		known, ok := knownTypes[path+"."+t.Sel.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s.%s", path, t.Sel.Name)
+		}
+		return known(), nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", e)
+}
+
+// jsonName returns the JSON name of field, whether it is omitted when empty
+// and whether it is inlined.
+func jsonName(field *ast.Field) (name string, omitempty, inline bool) {
+	if field.Tag == nil {
+		return "", false, false
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return "", false, false
+	}
+	parts := strings.Split(reflectTag(tag, "json"), ",")
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "omitempty":
+			omitempty = true
+		case "inline":
+			inline = true
+		}
+	}
+	return parts[0], omitempty, inline
+}
+
+// reflectTag returns the value of key in the struct tag tag.
+func reflectTag(tag, key string) string {
+	m := regexp.MustCompile(key + `:"([^"]*)"`).FindStringSubmatch(tag)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+func importPath(file *ast.File, name string) string {
+	for _, imp := range file.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		if imp.Name != nil {
+			if imp.Name.Name == name {
+				return path
+			}
+			continue
+		}
+		if filepath.Base(path) == name {
+			return path
+		}
+	}
+	return name
+}
+
+// description returns doc without its markers, as a single paragraph.
+func description(doc *ast.CommentGroup) string {
+	var lines []string
+	for _, line := range commentLines(doc) {
+		if line != "" && !strings.HasPrefix(line, "+") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, " ")
+}
+
+func commentLines(doc *ast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	var lines []string
+	for _, c := range doc.List {
+		lines = append(lines, strings.TrimSpace(strings.TrimPrefix(c.Text, "//")))
+	}
+	return lines
+}
+
+func hasMarker(doc *ast.CommentGroup, marker string) bool {
+	for _, line := range commentLines(doc) {
+		if line == marker {
+			return true
+		}
+	}
+	return false
+}
+
+var xValidation = regexp.MustCompile(`^rule=("(?:[^"\\]|\\.)*"),message=("(?:[^"\\]|\\.)*")$`)
+
+// applyMarkers applies the markers in doc to s.
+func applyMarkers(s schema, doc *ast.CommentGroup) error {
+	for _, line := range commentLines(doc) {
+		target := s
+		marker := line
+		switch {
+		case strings.HasPrefix(marker, "+listType="):
+			s["x-kubernetes-list-type"] = strings.TrimPrefix(marker, "+listType=")
+			continue
+		case strings.HasPrefix(marker, "+listMapKey="):
+			keys, _ := s["x-kubernetes-list-map-keys"].([]string)
+			s["x-kubernetes-list-map-keys"] = append(keys, strings.TrimPrefix(marker, "+listMapKey="))
+			continue
+		case !strings.HasPrefix(marker, "+kubebuilder:validation:"):
+			continue
+		}
+		marker = strings.TrimPrefix(marker, "+kubebuilder:validation:")
+		if strings.HasPrefix(marker, "items:") {
+			items, ok := s["items"].(schema)
+			if !ok {
+				return fmt.Errorf("%s applies to items, but there are none", line)
+			}
+			target, marker = items, strings.TrimPrefix(marker, "items:")
+		}
+		key, value := marker, ""
+		if i := strings.Index(marker, "="); i >= 0 && !strings.HasPrefix(marker, "XValidation:") {
+			key, value = marker[:i], marker[i+1:]
+		}
+		switch {
+		case key == "Pattern":
+			target["pattern"] = strings.Trim(value, "`")
+		case key == "Enum":
+			var values []interface{}
+			for _, v := range strings.Split(value, ";") {
+				values = append(values, v)
+			}
+			target["enum"] = values
+		case key == "Minimum" || key == "MinLength" || key == "MinItems":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %v", line, err)
+			}
+			target[strings.ToLower(key[:1])+key[1:]] = n
+		case key == "EmbeddedResource":
+			target["x-kubernetes-embedded-resource"] = true
+		case strings.HasPrefix(key, "XValidation:"):
+			m := xValidation.FindStringSubmatch(strings.TrimPrefix(key, "XValidation:"))
+			if m == nil {
+				return fmt.Errorf("%s: expected rule=\"...\",message=\"...\"", line)
+			}
+			rule, _ := strconv.Unquote(m[1])
+			message, _ := strconv.Unquote(m[2])
+			addValidations(target, []interface{}{schema{"rule": rule, "message": message}})
+		default:
+			return fmt.Errorf("unknown marker %s", line)
+		}
+	}
+	return nil
+}
+
+func addValidations(s schema, rules []interface{}) {
+	existing, _ := s["x-kubernetes-validations"].([]interface{})
+	s["x-kubernetes-validations"] = append(existing, rules...)
+}
+
+// knownTypes returns the schemas of the types of other packages the API
+// types use, by import path and name.
+var knownTypes = map[string]func() schema{
+	"k8s.io/apimachinery/pkg/apis/meta/v1.TypeMeta": func() schema {
+		return schema{"type": "object", "properties": schema{
+			"apiVersion": schema{"type": "string"},
+			"kind":       schema{"type": "string"},
+		}}
+	},
+	"k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta": func() schema {
+		return schema{"type": "object"}
+	},
+	"k8s.io/apimachinery/pkg/apis/meta/v1.Time": func() schema {
+		return schema{"type": "string", "format": "date-time"}
+	},
+	"k8s.io/apimachinery/pkg/apis/meta/v1.Duration": func() schema {
+		return schema{"type": "string"}
+	},
+	"k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector": func() schema {
+		return schema{"type": "object", "properties": schema{
+			"matchLabels": schema{"type": "object", "additionalProperties": schema{"type": "string"}},
+			"matchExpressions": schema{"type": "array", "items": schema{
+				"type":     "object",
+				"required": []string{"key", "operator"},
+				"properties": schema{
+					"key":      schema{"type": "string"},
+					"operator": schema{"type": "string"},
+					"values":   schema{"type": "array", "items": schema{"type": "string"}},
+				},
+			}},
+		}}
+	},
+	"k8s.io/apimachinery/pkg/runtime.RawExtension": func() schema {
+		return schema{"type": "object", "x-kubernetes-preserve-unknown-fields": true}
+	},
+	"k8s.io/apimachinery/pkg/util/intstr.IntOrString": intOrString,
+	"k8s.io/api/autoscaling/v1.CrossVersionObjectReference": func() schema {
+		return schema{"type": "object", "required": []string{"kind", "name"}, "properties": schema{
+			"apiVersion": schema{"type": "string"},
+			"kind":       schema{"type": "string", "minLength": 1},
+			"name":       schema{"type": "string", "minLength": 1},
+		}}
+	},
+	"k8s.io/api/core/v1.ResourceName": func() schema {
+		return schema{"type": "string"}
+	},
+	"k8s.io/api/core/v1.ResourceList": resourceList,
+	"k8s.io/api/core/v1.ResourceRequirements": func() schema {
+		return schema{"type": "object", "properties": schema{
+			"limits":   resourceList(),
+			"requests": resourceList(),
+		}}
+	},
+	"k8s.io/api/core/v1.Taint": func() schema {
+		return schema{"type": "object", "required": []string{"effect", "key"}, "properties": schema{
+			"key":       schema{"type": "string"},
+			"value":     schema{"type": "string"},
+			"effect":    schema{"type": "string", "enum": []interface{}{"NoSchedule", "PreferNoSchedule", "NoExecute"}},
+			"timeAdded": schema{"type": "string", "format": "date-time"},
+		}}
+	},
+}
+
+func intOrString() schema {
+	return schema{
+		"anyOf":                      []interface{}{schema{"type": "integer"}, schema{"type": "string"}},
+		"x-kubernetes-int-or-string": true,
+	}
+}
+
+// resourceList is the schema of quantities by resource name.
+func resourceList() schema {
+	return schema{"type": "object", "additionalProperties": intOrString()}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestUpToDate fails when the API types changed without running
+// go generate ./resources.
+func TestUpToDate(t *testing.T) {
+	files, err := generate("../../pkg/api/icp.ibm.com", "../../resources/crd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no templates")
+	}
+	for name, want := range files {
+		got, err := ioutil.ReadFile(filepath.Join("../../resources", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("resources/%s is out of date, run go generate ./resources", name)
+		}
+	}
+}
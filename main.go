@@ -2,14 +2,27 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"time"
+	// Policies name their time zone, bundle the zone database so the
+	// controller does not depend on the one of the image.
+	_ "time/tzdata"
 
 	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
+	"github.com/hchenxa/timebase/pkg/activator"
 	"github.com/hchenxa/timebase/pkg/client"
+	"github.com/hchenxa/timebase/pkg/client/clientset/versioned"
 	"github.com/hchenxa/timebase/pkg/controller"
+	"github.com/hchenxa/timebase/pkg/migrate"
+	"github.com/hchenxa/timebase/pkg/scale"
+	"github.com/hchenxa/timebase/pkg/webhook"
+	"github.com/hchenxa/timebase/resources"
 )
 
 var (
@@ -18,6 +31,21 @@ var (
 		"http://localhost:8080. If not specified, the assumption is that the binary runs inside a "+
 		"Kubernetes cluster and local discovery is attempted.")
 	argKubeConfigFile = pflag.String("kubeconfig", "", "Path to kubeconfig file with authorization and master location information.")
+	argInstallCRD     = pflag.Bool("install-crd", true, "Install or upgrade the Policy CustomResourceDefinition at startup.")
+	argMigrate        = pflag.String("migrate", "", "Run a migration of the Policy objects stored under the legacy "+
+		"ThirdPartyResource instead of the controller and exit. \"export\" saves the legacy objects to "+
+		"--migration-file, \"import\" rewrites them as CustomResourceDefinition objects, reading them from "+
+		"--migration-file if set or from the apiserver otherwise.")
+	argMigrationFile = pflag.String("migration-file", "", "File the legacy Policy objects are exported to or imported from.")
+	argDryRun        = pflag.Bool("dry-run", false, "Only report what an import would change.")
+	argWebhookAddr   = pflag.String("webhook-address", ":8443", "The address the conversion webhook listens on.")
+	argTLSCertFile   = pflag.String("tls-cert-file", "", "File containing the certificate of the conversion webhook. "+
+		"The webhook is only served when both --tls-cert-file and --tls-private-key-file are set.")
+	argTLSKeyFile    = pflag.String("tls-private-key-file", "", "File containing the private key of the conversion webhook.")
+	argWebhookCAFile = pflag.String("webhook-ca-file", "", "File containing the CA bundle the apiserver uses to verify "+
+		"the conversion webhook, it is written into the installed CustomResourceDefinition.")
+	argActivatorAddr = pflag.String("activator-address", "", "The IP and port the activator listens on and routes "+
+		"the Services of sleeping namespaces to, e.g., $(POD_IP):8012. The activator is disabled when not set.")
 )
 
 // lables correspond to labels in the Kubernetes API.
@@ -36,7 +64,7 @@ func main() {
 		handleFatalInitError(err)
 	}
 
-	restClient, scheme, err := client.CreateRestClient(*argApiserverHost, *argKubeConfigFile)
+	restClient, _, err := client.CreateRestClient(*argApiserverHost, *argKubeConfigFile)
 	if err != nil {
 		handleFatalInitError(err)
 	}
@@ -47,11 +75,47 @@ func main() {
 	}
 	log.Printf("Successful initial request to the apiserver, version: %s", versionInfo.String())
 
+	policyClient, err := client.CreatePolicyClient(*argApiserverHost, *argKubeConfigFile)
+	if err != nil {
+		handleFatalInitError(err)
+	}
+
+	if *argMigrate != "" {
+		if err := runMigration(*argMigrate, apiserverClient, restClient, policyClient); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	// The webhook has to be up before the informers list policies that are
+	// stored in another version.
+	if webhookEnabled() {
+		go func() {
+			log.Fatalf("Conversion webhook failed: %v", webhook.Serve(*argWebhookAddr, *argTLSCertFile, *argTLSKeyFile))
+		}()
+	}
+
+	if *argInstallCRD {
+		if err := ensureCRD(apiserverClient); err != nil {
+			log.Fatalf("Error while installing the Policy CustomResourceDefinition: %v", err)
+		}
+	}
+
+	var act *activator.Activator
+	if *argActivatorAddr != "" {
+		if act, err = activator.New(apiserverClient, scale.New(apiserverClient), *argActivatorAddr); err != nil {
+			handleFatalInitError(err)
+		}
+		go func() {
+			log.Fatalf("Activator failed: %v", act.Serve())
+		}()
+	}
+
 	pc := controller.NewTimebasedController(&controller.Configuration{
-		RESTClient:   restClient,
+		PolicyClient: policyClient,
 		Client:       apiserverClient,
-		Scheme:       scheme,
 		ResyncPeriod: 5 * time.Minute,
+		Activator:    act,
 	})
 
 	stop := make(chan struct{})
@@ -59,6 +123,81 @@ func main() {
 	pc.Run(stop)
 }
 
+// ensureCRD installs or upgrades the Policy, ClusterPolicy and Hibernation
+// CustomResourceDefinitions. Policy converts between its versions through the
+// webhook if it is served, otherwise only its storage version is served.
+func ensureCRD(apiserverClient *kubernetes.Clientset) error {
+	var hook *client.Webhook
+	if webhookEnabled() {
+		hook = &client.Webhook{}
+		if *argWebhookCAFile != "" {
+			var err error
+			if hook.CABundle, err = ioutil.ReadFile(*argWebhookCAFile); err != nil {
+				return err
+			}
+		}
+	}
+	for _, crd := range [][]byte{resources.PolicyCRD, resources.ClusterPolicyCRD, resources.HibernationCRD} {
+		if err := client.EnsureCustomResourceDefinition(apiserverClient, crd, hook); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// webhookEnabled reports whether the conversion webhook is served.
+func webhookEnabled() bool {
+	return *argTLSCertFile != "" && *argTLSKeyFile != ""
+}
+
+// runMigration exports or imports the Policy objects stored under the legacy
+// ThirdPartyResource and reports what was changed or skipped.
+func runMigration(mode string, apiserverClient *kubernetes.Clientset, restClient *rest.RESTClient, policyClient *versioned.Clientset) error {
+	switch mode {
+	case "export":
+		if *argMigrationFile == "" {
+			return fmt.Errorf("--migration-file is required to export")
+		}
+		list, err := migrate.List(restClient)
+		if err != nil {
+			return err
+		}
+		if err := migrate.WriteFile(*argMigrationFile, list); err != nil {
+			return err
+		}
+		log.Printf("Exported %d legacy policies to %s", len(list.Items), *argMigrationFile)
+		return nil
+	case "import":
+		var list *migrate.LegacyPolicyList
+		var err error
+		if *argMigrationFile != "" {
+			list, err = migrate.ReadFile(*argMigrationFile)
+		} else {
+			list, err = migrate.List(restClient)
+		}
+		if err != nil {
+			return err
+		}
+		if *argInstallCRD && !*argDryRun {
+			if err := ensureCRD(apiserverClient); err != nil {
+				return err
+			}
+		}
+
+		entries, err := migrate.Import(policyClient.IcpV1beta2(), list, *argDryRun)
+		counts := map[migrate.Result]int{}
+		for _, e := range entries {
+			log.Print(e)
+			counts[e.Result]++
+		}
+		log.Printf("Migrated %d legacy policies: %d created, %d updated, %d skipped",
+			len(entries), counts[migrate.Created], counts[migrate.Updated], counts[migrate.Skipped])
+		return err
+	default:
+		return fmt.Errorf("unknown migration %q, expected \"export\" or \"import\"", mode)
+	}
+}
+
 func handleFatalInitError(err error) {
 	log.Fatalf("Error while initializing connection to Kubernetes apiserver. "+
 		"This most likely means that the cluster is misconfigured (e.g., it has "+
@@ -0,0 +1,486 @@
+// Package activator serves the Services of sleeping namespaces. While a
+// namespace sleeps its Services are routed to the activator, which wakes the
+// workload behind a Service up when it is requested, holds the request until
+// the workload has ready pods and then forwards it to one of them. Once the
+// workload is up the controller hands the Service back to its pods.
+package activator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"github.com/hchenxa/timebase/pkg/scale"
+)
+
+const (
+	// SelectorAnnotation holds the selector of a Service while it is routed
+	// to the activator.
+	SelectorAnnotation = "icp.ibm.com/activator-selector"
+
+	// activationTimeout bounds how long a request is held while its
+	// workload wakes up.
+	activationTimeout = 2 * time.Minute
+	// pollInterval is how often the ready pods of a waking workload are
+	// looked up.
+	pollInterval = 500 * time.Millisecond
+	// refreshInterval is how long the ready pods of an awake workload are
+	// reused before they are looked up again.
+	refreshInterval = 10 * time.Second
+)
+
+// Activator is the reverse proxy Services are routed to while their
+// namespace sleeps.
+type Activator struct {
+	kubeClient kubernetes.Interface
+	scales     scale.Interface
+	// ip and port are where Services are routed to, addr is what the
+	// activator listens on.
+	ip   string
+	port int32
+	addr string
+
+	lock     sync.Mutex
+	services map[string]*service
+}
+
+// service is a Service routed to the activator.
+type service struct {
+	namespace string
+	name      string
+	clusterIP string
+	ports     []v1.ServicePort
+	selector  labels.Selector
+	target    autoscaling.CrossVersionObjectReference
+	replicas  int32
+
+	// woken is set once a request woke the workload up and was forwarded
+	// to it. It is guarded by the lock of the Activator.
+	woken bool
+
+	// lock serializes wake ups, the requests that arrive meanwhile are
+	// held on it. It guards the fields below.
+	lock      sync.Mutex
+	pods      []v1.Pod
+	refreshed time.Time
+	next      int
+}
+
+// New returns an activator that Services are routed to at address, an
+// IP:port the activator also listens on.
+func New(kubeClient kubernetes.Interface, scales scale.Interface, address string) (*Activator, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("the activator address %s does not hold an IP", address)
+	}
+	p, err := strconv.ParseInt(port, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid activator port %s: %v", port, err)
+	}
+	return &Activator{
+		kubeClient: kubeClient,
+		scales:     scales,
+		ip:         host,
+		port:       int32(p),
+		addr:       address,
+		services:   map[string]*service{},
+	}, nil
+}
+
+// Serve serves the routed Services until it fails.
+func (a *Activator) Serve() error {
+	glog.Infof("Serving the activator on %s", a.addr)
+	return http.ListenAndServe(a.addr, a)
+}
+
+// Take routes the named Service in namespace to the activator, keeping its
+// selector in an annotation. A request to it wakes its workload up to
+// replicas. Take is called when the namespace falls asleep and once per
+// resync period after, which also serves the Services again after a restart.
+//
+// The activator only proxies HTTP, so only the HTTP ports of the Service
+// are routed to it. The others, which it returns, get no endpoints while the
+// namespace sleeps. A Service without any HTTP port is not taken.
+func (a *Activator) Take(namespace string, as api.ActivatedService, replicas int32) ([]string, error) {
+	svc, appProtocols, err := a.getService(namespace, as.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(svc.Spec.Ports) == 0 {
+		return nil, fmt.Errorf("Service %s/%s has no ports", namespace, as.Name)
+	}
+	var ports []v1.ServicePort
+	var unrouted []string
+	for _, sp := range svc.Spec.Ports {
+		if httpPort(sp, appProtocols[sp.Name]) {
+			ports = append(ports, sp)
+			continue
+		}
+		if sp.Name != "" {
+			unrouted = append(unrouted, sp.Name)
+		} else {
+			unrouted = append(unrouted, strconv.Itoa(int(sp.Port)))
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("Service %s/%s has no HTTP port, name one http or http-<suffix> or set its appProtocol to http", namespace, as.Name)
+	}
+
+	services := a.kubeClient.CoreV1().Services(namespace)
+	selector := svc.Spec.Selector
+	switch saved, ok := svc.Annotations[SelectorAnnotation]; {
+	case len(selector) > 0:
+		raw, err := json.Marshal(selector)
+		if err != nil {
+			return nil, err
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{"annotations": map[string]string{SelectorAnnotation: string(raw)}},
+			"spec":     map[string]interface{}{"selector": nil},
+		})
+		if err != nil {
+			return nil, err
+		}
+		glog.V(2).Infof("activator takes Service %s/%s", namespace, as.Name)
+		if svc, err = services.Patch(as.Name, types.MergePatchType, patch); err != nil {
+			return nil, err
+		}
+	case ok:
+		if err := json.Unmarshal([]byte(saved), &selector); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation on Service %s/%s: %v", SelectorAnnotation, namespace, as.Name, err)
+		}
+	default:
+		return nil, fmt.Errorf("Service %s/%s has no selector", namespace, as.Name)
+	}
+	if err := a.ensureEndpoints(svc, ports); err != nil {
+		return nil, err
+	}
+
+	key := namespace + "/" + as.Name
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	s, ok := a.services[key]
+	if !ok {
+		s = &service{namespace: namespace, name: as.Name}
+		a.services[key] = s
+	}
+	s.clusterIP = svc.Spec.ClusterIP
+	s.ports = ports
+	s.selector = labels.SelectorFromSet(selector)
+	s.target = as.ScaleTargetRef
+	s.replicas = replicas
+	s.woken = false
+	s.lock.Lock()
+	s.pods = nil
+	s.lock.Unlock()
+	return unrouted, nil
+}
+
+// getService returns the named Service in namespace and the appProtocol of
+// its ports by name. The vendored API predates appProtocol, so it is read
+// from the Service as served.
+func (a *Activator) getService(namespace, name string) (*v1.Service, map[string]string, error) {
+	raw, err := a.kubeClient.CoreV1().RESTClient().Get().Namespace(namespace).Resource("services").Name(name).DoRaw()
+	if err != nil {
+		return nil, nil, err
+	}
+	svc := &v1.Service{}
+	if err := json.Unmarshal(raw, svc); err != nil {
+		return nil, nil, err
+	}
+	served := struct {
+		Spec struct {
+			Ports []struct {
+				Name        string `json:"name"`
+				AppProtocol string `json:"appProtocol"`
+			} `json:"ports"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(raw, &served); err != nil {
+		return nil, nil, err
+	}
+	appProtocols := map[string]string{}
+	for _, p := range served.Spec.Ports {
+		appProtocols[p.Name] = p.AppProtocol
+	}
+	return svc, appProtocols, nil
+}
+
+// httpPort reports whether sp carries HTTP: its appProtocol is http or,
+// without one, it is named http or http-<suffix>, the convention of service
+// meshes.
+func httpPort(sp v1.ServicePort, appProtocol string) bool {
+	if sp.Protocol != "" && sp.Protocol != v1.ProtocolTCP {
+		return false
+	}
+	if appProtocol != "" {
+		return strings.EqualFold(appProtocol, "http")
+	}
+	return sp.Name == "http" || strings.HasPrefix(sp.Name, "http-")
+}
+
+// ensureEndpoints points ports of svc at the activator. The endpoints
+// controller leaves the endpoints of a Service without a selector alone.
+func (a *Activator) ensureEndpoints(svc *v1.Service, ports []v1.ServicePort) error {
+	subset := v1.EndpointSubset{Addresses: []v1.EndpointAddress{{IP: a.ip}}}
+	for _, sp := range ports {
+		subset.Ports = append(subset.Ports, v1.EndpointPort{Name: sp.Name, Port: a.port, Protocol: v1.ProtocolTCP})
+	}
+	subsets := []v1.EndpointSubset{subset}
+
+	endpoints := a.kubeClient.CoreV1().Endpoints(svc.Namespace)
+	ep, err := endpoints.Get(svc.Name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = endpoints.Create(&v1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: svc.Name, Namespace: svc.Namespace},
+			Subsets:    subsets,
+		})
+		return err
+	case err != nil:
+		return err
+	case equality.Semantic.DeepEqual(ep.Subsets, subsets):
+		return nil
+	}
+	ep.Subsets = subsets
+	_, err = endpoints.Update(ep)
+	return err
+}
+
+// Forget stops serving the named Service in namespace.
+func (a *Activator) Forget(namespace, name string) {
+	a.lock.Lock()
+	delete(a.services, namespace+"/"+name)
+	a.lock.Unlock()
+}
+
+// Release hands the named Service in namespace back to its pods by restoring
+// the selector Take saved. The endpoints controller then routes it to them
+// again. It needs no activator, so that Services can be handed back by a
+// controller running without one.
+func Release(kubeClient kubernetes.Interface, namespace, name string) error {
+	services := kubeClient.CoreV1().Services(namespace)
+	svc, err := services.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	saved, ok := svc.Annotations[SelectorAnnotation]
+	if !ok {
+		return nil
+	}
+	selector := map[string]string{}
+	if err := json.Unmarshal([]byte(saved), &selector); err != nil {
+		return fmt.Errorf("invalid %s annotation on Service %s/%s: %v", SelectorAnnotation, namespace, name, err)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]interface{}{SelectorAnnotation: nil}},
+		"spec":     map[string]interface{}{"selector": selector},
+	})
+	if err != nil {
+		return err
+	}
+	glog.V(2).Infof("activator releases Service %s/%s", namespace, name)
+	_, err = services.Patch(name, types.MergePatchType, patch)
+	return err
+}
+
+// Woken reports whether a request to the named Service in namespace woke its
+// workload up and was forwarded to a ready pod, so that the Service can be
+// handed back to its pods.
+func (a *Activator) Woken(namespace, name string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	s, ok := a.services[namespace+"/"+name]
+	return ok && s.woken
+}
+
+// ServeHTTP wakes up the workload behind the Service a request is for and
+// forwards the request to it.
+func (a *Activator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s := a.lookup(r.Host)
+	if s == nil {
+		http.Error(w, fmt.Sprintf("no sleeping Service serves %s", r.Host), http.StatusNotFound)
+		return
+	}
+
+	target, err := a.activate(r.Context(), s, s.port(r.Host))
+	if err != nil {
+		glog.Errorf("activator cannot serve Service %s/%s: %v", s.namespace, s.name, err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	a.lock.Lock()
+	s.woken = true
+	a.lock.Unlock()
+	httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+}
+
+// lookup returns the Service host names: a name qualified with its
+// namespace, as in name.namespace.svc.cluster.local, a cluster IP, or a bare
+// name that a single routed Service has.
+func (a *Activator) lookup(host string) *service {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	parts := strings.Split(host, ".")
+	if len(parts) >= 2 {
+		if s, ok := a.services[parts[1]+"/"+parts[0]]; ok {
+			return s
+		}
+	}
+	var found *service
+	for _, s := range a.services {
+		if s.clusterIP == host {
+			return s
+		}
+		if len(parts) == 1 && s.name == host {
+			if found != nil {
+				return nil
+			}
+			found = s
+		}
+	}
+	return found
+}
+
+// port returns the HTTP port of s a request to host is for: the one host
+// names, else port 80, else the first one.
+func (s *service) port(host string) v1.ServicePort {
+	if _, p, err := net.SplitHostPort(host); err == nil {
+		for _, sp := range s.ports {
+			if strconv.Itoa(int(sp.Port)) == p {
+				return sp
+			}
+		}
+	}
+	for _, sp := range s.ports {
+		if sp.Port == 80 {
+			return sp
+		}
+	}
+	return s.ports[0]
+}
+
+// activate returns the address of a ready pod of s to forward a request for
+// port sp to. When the pods of s are stale the workload is scaled up, if it
+// sits at zero, and its ready pods are waited for.
+func (a *Activator) activate(ctx context.Context, s *service, sp v1.ServicePort) (*url.URL, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.pods) == 0 || time.Since(s.refreshed) > refreshInterval {
+		if err := a.wake(ctx, s); err != nil {
+			return nil, err
+		}
+	}
+	pod := &s.pods[s.next%len(s.pods)]
+	s.next++
+	port, ok := podPort(pod, sp)
+	if !ok {
+		return nil, fmt.Errorf("pod %s/%s has no port %s", pod.Namespace, pod.Name, sp.TargetPort.String())
+	}
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(port)))}, nil
+}
+
+// wake scales the workload of s up if it sits at zero and waits until it
+// has ready pods. The caller holds the lock of s.
+func (a *Activator) wake(ctx context.Context, s *service) error {
+	sc, err := a.scales.Get(s.namespace, s.target)
+	if err != nil {
+		return fmt.Errorf("failed to query scale subresource: %v", err)
+	}
+	if sc.Spec.Replicas == 0 {
+		glog.V(2).Infof("activator wakes %s/%s/%s up to %d", s.target.Kind, s.namespace, s.target.Name, s.replicas)
+		sc.Spec.Replicas = s.replicas
+		if _, err := a.scales.Update(s.namespace, s.target, sc); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, activationTimeout)
+	defer cancel()
+	for {
+		pods, err := a.readyPods(s)
+		if err == nil && len(pods) > 0 {
+			s.pods, s.refreshed = pods, time.Now()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+			return fmt.Errorf("%s/%s/%s has no ready pods: %v", s.target.Kind, s.namespace, s.target.Name, err)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// readyPods returns the pods the selector of s matches that are ready.
+func (a *Activator) readyPods(s *service) ([]v1.Pod, error) {
+	list, err := a.kubeClient.CoreV1().Pods(s.namespace).List(metav1.ListOptions{LabelSelector: s.selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	var pods []v1.Pod
+	for _, pod := range list.Items {
+		if pod.DeletionTimestamp == nil && pod.Status.PodIP != "" && isReady(&pod) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+func isReady(pod *v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podPort returns the port of pod the target port of sp refers to.
+func podPort(pod *v1.Pod, sp v1.ServicePort) (int32, bool) {
+	switch {
+	case sp.TargetPort.Type == intstr.String:
+		for _, c := range pod.Spec.Containers {
+			for _, p := range c.Ports {
+				if p.Name == sp.TargetPort.StrVal {
+					return p.ContainerPort, true
+				}
+			}
+		}
+		return 0, false
+	case sp.TargetPort.IntVal != 0:
+		return sp.TargetPort.IntVal, true
+	}
+	return sp.Port, true
+}
@@ -0,0 +1,161 @@
+package v1
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+// HubSpecAnnotation keeps the v1beta2 spec of a policy that cannot be
+// expressed in v1, such as additional rules, so that reading and writing
+// back a v1 object does not lose them.
+const HubSpecAnnotation = "icp.ibm.com/v1beta2-spec"
+
+// HubStatusAnnotation keeps the v1beta2 status of a policy that cannot be
+// expressed in v1, such as the state of its windows, so that a v1 status
+// update does not wipe it.
+const HubStatusAnnotation = "icp.ibm.com/v1beta2-status"
+
+// DefaultRuleName is the name of the rule a v1 policy converts to.
+const DefaultRuleName = "default"
+
+// ConvertTo converts this policy to the hub version.
+func (src *Policy) ConvertTo(dst *v1beta2.Policy) error {
+	dst.TypeMeta = metav1.TypeMeta{APIVersion: v1beta2.SchemeGroupVersion.String(), Kind: "Policy"}
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	dst.Spec = v1beta2.PolicySpec{}
+	if err := takeAnnotation(&dst.ObjectMeta, HubSpecAnnotation, &dst.Spec); err != nil {
+		return err
+	}
+	dst.Status = v1beta2.PolicyStatus{}
+	if err := takeAnnotation(&dst.ObjectMeta, HubStatusAnnotation, &dst.Status); err != nil {
+		return err
+	}
+
+	// The v1 fields always describe the first rule, they win over the
+	// annotation so that edits made through v1 are kept. A policy made only
+	// of windows has no rule and leaves them empty.
+	rule := v1beta2.PolicyRule{
+		Name:     DefaultRuleName,
+		Schedule: src.Spec.Schedule,
+		Action:   v1beta2.ActionType(src.Spec.Action),
+		Replicas: src.Spec.TargetReplicas,
+	}
+	switch {
+	case len(dst.Spec.Rules) > 0:
+		first := &dst.Spec.Rules[0]
+		first.Schedule, first.Action, first.Replicas = rule.Schedule, rule.Action, rule.Replicas
+	case src.Spec.Schedule != "" || len(dst.Spec.Windows) == 0:
+		dst.Spec.Rules = []v1beta2.PolicyRule{rule}
+	}
+	if src.Spec.ScaleTargetRef.Name != "" || dst.Spec.TargetSelector == nil {
+		ref := src.Spec.ScaleTargetRef
+		dst.Spec.ScaleTargetRef = &ref
+	}
+
+	// Likewise the v1 status describes the first rule and wins over the
+	// annotation, which holds the rest.
+	dst.Status.LastScheduleTime = src.Status.LastScheduleTime.DeepCopy()
+	dst.Status.NextScheduleTime = src.Status.NextScheduleTime.DeepCopy()
+	if len(dst.Spec.Rules) == 0 {
+		return nil
+	}
+	name := dst.Spec.Rules[0].Name
+	for i := range dst.Status.Rules {
+		if dst.Status.Rules[i].Name == name {
+			dst.Status.Rules[i].LastScheduleTime = src.Status.LastScheduleTime.DeepCopy()
+			dst.Status.Rules[i].NextScheduleTime = src.Status.NextScheduleTime.DeepCopy()
+			return nil
+		}
+	}
+	if src.Status.LastScheduleTime != nil || src.Status.NextScheduleTime != nil {
+		dst.Status.Rules = append([]v1beta2.RuleStatus{{
+			Name:             name,
+			LastScheduleTime: src.Status.LastScheduleTime.DeepCopy(),
+			NextScheduleTime: src.Status.NextScheduleTime.DeepCopy(),
+		}}, dst.Status.Rules...)
+	}
+	return nil
+}
+
+// ConvertFrom converts the hub version to this policy. The first rule maps to
+// the v1 fields; when the hub spec or status holds more than that it is kept
+// in the HubSpecAnnotation or HubStatusAnnotation.
+func (dst *Policy) ConvertFrom(src *v1beta2.Policy) error {
+	dst.TypeMeta = metav1.TypeMeta{APIVersion: SchemeGroupVersion.String(), Kind: "Policy"}
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	dst.Spec = PolicySpec{}
+	if src.Spec.ScaleTargetRef != nil {
+		dst.Spec.ScaleTargetRef = *src.Spec.ScaleTargetRef
+	}
+	if len(src.Spec.Rules) > 0 {
+		rule := src.Spec.Rules[0]
+		dst.Spec.Schedule = rule.Schedule
+		dst.Spec.Action = ActionSpec(rule.Action)
+		dst.Spec.TargetReplicas = rule.Replicas
+	}
+
+	if !isV1Expressible(&dst.Spec, &src.Spec) {
+		if err := setAnnotation(&dst.ObjectMeta, HubSpecAnnotation, &src.Spec); err != nil {
+			return err
+		}
+	}
+
+	dst.Status = PolicyStatus{
+		LastScheduleTime: src.Status.LastScheduleTime.DeepCopy(),
+		NextScheduleTime: src.Status.NextScheduleTime.DeepCopy(),
+	}
+	back := &v1beta2.Policy{}
+	if err := dst.ConvertTo(back); err != nil {
+		return err
+	}
+	if !equality.Semantic.DeepEqual(&back.Status, &src.Status) {
+		return setAnnotation(&dst.ObjectMeta, HubStatusAnnotation, &src.Status)
+	}
+	return nil
+}
+
+// setAnnotation keeps value as JSON in the annotation key of meta.
+func setAnnotation(meta *metav1.ObjectMeta, key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[key] = string(raw)
+	return nil
+}
+
+// takeAnnotation decodes the annotation key of meta, if it is set, into
+// value and removes it.
+func takeAnnotation(meta *metav1.ObjectMeta, key string, value interface{}) error {
+	raw, ok := meta.Annotations[key]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(raw), value); err != nil {
+		return err
+	}
+	delete(meta.Annotations, key)
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+	return nil
+}
+
+// isV1Expressible reports whether converting the v1 spec back to the hub
+// gives hub again, that is whether nothing in hub was lost on the way.
+func isV1Expressible(spec *PolicySpec, hub *v1beta2.PolicySpec) bool {
+	back := &v1beta2.Policy{}
+	if err := (&Policy{Spec: *spec}).ConvertTo(back); err != nil {
+		return false
+	}
+	return equality.Semantic.DeepEqual(&back.Spec, hub)
+}
@@ -1,2 +1,3 @@
 // +k8s:deepcopy-gen=package
+// +groupName=icp.ibm.com
 package v1
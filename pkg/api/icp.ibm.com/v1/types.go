@@ -6,6 +6,7 @@ import (
 )
 
 // ActionSpec is to define the action of the policy
+// +kubebuilder:validation:Enum=scaleUp;scaleDown
 type ActionSpec string
 
 const (
@@ -15,29 +16,38 @@ const (
 	ScaleDown ActionSpec = "scaleDown"
 )
 
-// Status show the current status of policy
-type Status struct {
-	CreationTimestamp *metav1.Time
-	LastScheduleTime  *metav1.Time
-}
-
 // PolicySpec define the spec of the policy
 type PolicySpec struct {
-	Action         ActionSpec                              `json:"action"`
+	Action ActionSpec `json:"action"`
+	// Schedule is a standard five field cron expression or a predefined
+	// descriptor such as @daily.
+	// +kubebuilder:validation:Pattern=`^(@(yearly|annually|monthly|weekly|daily|midnight|hourly)|@every [0-9a-z.]+|\S+( +\S+){4})$`
 	Schedule       string                                  `json:"schedule"`
 	ScaleTargetRef autoscaling.CrossVersionObjectReference `json:"scaleTargetRef"`
-	TargetReplicas int32                                   `json:"replicas,omitempty"`
-	Status         Status                                  `json:"status"`
+	// +kubebuilder:validation:Minimum=0
+	TargetReplicas int32 `json:"replicas,omitempty"`
+}
+
+// PolicyStatus show the current status of policy, it is written through the
+// status subresource so it survives controller restarts.
+type PolicyStatus struct {
+	// LastScheduleTime is the most recent schedule time that was handled.
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// NextScheduleTime is the next time the schedule will fire.
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
 }
 
+// +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
-// Policy represents a JSON object for the CronTab custom resource that we register in the Kubernetes API.
+// Policy is a time based policy, it scales its target to the replicas on its
+// schedule.
 type Policy struct {
 	// The following fields mirror the fields in the third party resource.
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
-	Spec              PolicySpec `json:"spec"`
+	Spec              PolicySpec   `json:"spec"`
+	Status            PolicyStatus `json:"status,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
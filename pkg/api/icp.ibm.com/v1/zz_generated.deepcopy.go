@@ -45,9 +45,9 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			return nil
 		}, InType: reflect.TypeOf(&PolicySpec{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
-			in.(*Status).DeepCopyInto(out.(*Status))
+			in.(*PolicyStatus).DeepCopyInto(out.(*PolicyStatus))
 			return nil
-		}, InType: reflect.TypeOf(&Status{})},
+		}, InType: reflect.TypeOf(&PolicyStatus{})},
 	}
 }
 
@@ -56,7 +56,8 @@ func (in *Policy) DeepCopyInto(out *Policy) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -117,7 +118,6 @@ func (in *PolicyList) DeepCopyObject() runtime.Object {
 func (in *PolicySpec) DeepCopyInto(out *PolicySpec) {
 	*out = *in
 	out.ScaleTargetRef = in.ScaleTargetRef
-	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -132,10 +132,10 @@ func (in *PolicySpec) DeepCopy() *PolicySpec {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Status) DeepCopyInto(out *Status) {
+func (in *PolicyStatus) DeepCopyInto(out *PolicyStatus) {
 	*out = *in
-	if in.CreationTimestamp != nil {
-		in, out := &in.CreationTimestamp, &out.CreationTimestamp
+	if in.LastScheduleTime != nil {
+		in, out := &in.LastScheduleTime, &out.LastScheduleTime
 		if *in == nil {
 			*out = nil
 		} else {
@@ -143,8 +143,8 @@ func (in *Status) DeepCopyInto(out *Status) {
 			(*in).DeepCopyInto(*out)
 		}
 	}
-	if in.LastScheduleTime != nil {
-		in, out := &in.LastScheduleTime, &out.LastScheduleTime
+	if in.NextScheduleTime != nil {
+		in, out := &in.NextScheduleTime, &out.NextScheduleTime
 		if *in == nil {
 			*out = nil
 		} else {
@@ -155,12 +155,12 @@ func (in *Status) DeepCopyInto(out *Status) {
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Status.
-func (in *Status) DeepCopy() *Status {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyStatus.
+func (in *PolicyStatus) DeepCopy() *PolicyStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(Status)
+	out := new(PolicyStatus)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -0,0 +1,965 @@
+package v1beta2
+
+import (
+	autoscaling "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ActionType is the kind of change a rule applies to the target
+// +kubebuilder:validation:Enum=scaleUp;scaleDown;set;scaleBy;scaleByPercent;restore;restart;nodeMaintenance
+type ActionType string
+
+const (
+	// ScaleUp raises the target to the requested replicas, it never lowers it
+	ScaleUp ActionType = "scaleUp"
+	// ScaleDown lowers the target to the requested replicas, it never raises it
+	ScaleDown ActionType = "scaleDown"
+	// Set sets the target to the requested replicas in either direction
+	Set ActionType = "set"
+	// ScaleBy changes the scale of the target by Delta replicas
+	ScaleBy ActionType = "scaleBy"
+	// ScaleByPercent sets the target to the baseline scale changed by Percent
+	// percent
+	ScaleByPercent ActionType = "scaleByPercent"
+	// Restore returns the target to the scale it had before the policy first
+	// changed it
+	Restore ActionType = "restore"
+	// Restart rolls the pods of the target, a Deployment, StatefulSet or
+	// DaemonSet, out again, like kubectl rollout restart
+	Restart ActionType = "restart"
+	// MaintainNodes takes the nodes of NodeMaintenance into maintenance
+	// in turn, each for its node duration; it acts on the nodes rather than
+	// on the target
+	MaintainNodes ActionType = "nodeMaintenance"
+)
+
+// Strategy is the way the scales asked for by the policies of one target are
+// combined into a single one
+// +kubebuilder:validation:Enum=max;min;priority
+type Strategy string
+
+const (
+	// StrategyMax runs the target at the largest scale any policy asks for
+	StrategyMax Strategy = "max"
+	// StrategyMin runs the target at the smallest scale any policy asks for
+	StrategyMin Strategy = "min"
+	// StrategyPriority runs the target at the scale the policy with the
+	// highest priority asks for, ties are broken as with StrategyMax
+	StrategyPriority Strategy = "priority"
+)
+
+// PolicyRule is a single schedule of a policy and the action it triggers
+// +kubebuilder:validation:XValidation:rule="self.action != 'scaleBy' || has(self.delta)",message="scaleBy needs a delta"
+// +kubebuilder:validation:XValidation:rule="self.action != 'scaleByPercent' || has(self.percent)",message="scaleByPercent needs a percent"
+// +kubebuilder:validation:XValidation:rule="self.action != 'nodeMaintenance' || has(self.nodeMaintenance) && has(self.nodeMaintenance.nodeDuration)",message="nodeMaintenance rules need nodeMaintenance with a nodeDuration"
+type PolicyRule struct {
+	// Name identifies the rule in the status, it must be unique in the policy
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Schedule is a standard five field cron expression or a predefined
+	// descriptor such as @daily.
+	// +kubebuilder:validation:Pattern=`^(@(yearly|annually|monthly|weekly|daily|midnight|hourly)|@every [0-9a-z.]+|\S+( +\S+){4})$`
+	Schedule string     `json:"schedule"`
+	Action   ActionType `json:"action"`
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas,omitempty"`
+	// Delta is the number of replicas ScaleBy adds, or removes when negative.
+	Delta int32 `json:"delta,omitempty"`
+	// Percent is the change ScaleByPercent applies to the baseline, 50 runs
+	// the target at one and a half times the baseline and -50 at half of it.
+	// +kubebuilder:validation:Minimum=-100
+	Percent int32 `json:"percent,omitempty"`
+	// ProgressDeadline is how long the rollout a Restart rule starts may
+	// take before it counts as failed. When unset a Deployment fails on its
+	// own progressDeadlineSeconds, and a StatefulSet or DaemonSet after ten
+	// minutes.
+	ProgressDeadline *metav1.Duration `json:"progressDeadline,omitempty"`
+	// NodeMaintenance are the nodes a MaintainNodes rule takes into
+	// maintenance and how. Each time the rule fires every selected node has
+	// its turn once.
+	NodeMaintenance *NodeMaintenance `json:"nodeMaintenance,omitempty"`
+	// Lead makes the rule fire ahead of its schedule time.
+	Lead `json:",inline"`
+}
+
+// Lead makes a rule fire, or a window open, ahead of its schedule, so that
+// the capacity it asks for is ready by the time it is scheduled.
+type Lead struct {
+	// LeadTime is how long ahead of its schedule time the rule or window
+	// acts.
+	LeadTime *metav1.Duration `json:"leadTime,omitempty"`
+	// LearnLeadTime replaces LeadTime by the longest time the pods of the
+	// target took to become ready in the recent runs, once there are any.
+	LearnLeadTime bool `json:"learnLeadTime,omitempty"`
+}
+
+// WindowAction is the kind of change a window makes to the target while it
+// is open
+// +kubebuilder:validation:Enum=scale;resources;suspend;parallelism;patch;manifests;nodeMaintenance;quota;trafficShift
+type WindowAction string
+
+const (
+	// ScaleWindow holds the target at the scale of the window, it is the
+	// default
+	ScaleWindow WindowAction = "scale"
+	// ResourcesWindow sets the compute resources of containers of the pod
+	// template of the target, and puts back the ones they had once the
+	// window closes
+	ResourcesWindow WindowAction = "resources"
+	// SuspendWindow sets whether the target, a CronJob, is suspended, and
+	// puts back what it was once the window closes
+	SuspendWindow WindowAction = "suspend"
+	// ParallelismWindow sets the parallelism of the target, a Job, and puts
+	// back the one it had once the window closes
+	ParallelismWindow WindowAction = "parallelism"
+	// PatchWindow patches the target when the window opens, and reverts
+	// the patch once it closes
+	PatchWindow WindowAction = "patch"
+	// ManifestsWindow creates objects when the window opens and deletes
+	// them once it closes. It does not act on the target of the policy
+	ManifestsWindow WindowAction = "manifests"
+	// NodeMaintenanceWindow cordons and taints nodes while the window is
+	// open, and restores them once it closes. It does not act on the target
+	// of the policy
+	NodeMaintenanceWindow WindowAction = "nodeMaintenance"
+	// QuotaWindow sets hard limits of ResourceQuotas in the namespace of the
+	// policy while the window is open, and restores them once it closes. It
+	// does not act on the target of the policy
+	QuotaWindow WindowAction = "quota"
+	// TrafficShiftWindow holds the target at the scale of the window like
+	// ScaleWindow, and once enough of its pods are ready sends it traffic,
+	// which goes back once the window closes
+	TrafficShiftWindow WindowAction = "trafficShift"
+)
+
+// ScalingWindow is a recurring period during which the target runs at a
+// given scale. It starts on Start and lasts until the next time End fires, or
+// for Duration, whichever of the two is set.
+// +kubebuilder:validation:XValidation:rule="has(self.end) != has(self.duration)",message="exactly one of end and duration must be set"
+// +kubebuilder:validation:XValidation:rule="(has(self.action) && self.action != 'scale' && self.action != 'trafficShift') || has(self.replicas)",message="scale and trafficShift windows need replicas"
+// +kubebuilder:validation:XValidation:rule="!has(self.action) || self.action != 'resources' || has(self.resources)",message="resources windows need resources"
+// +kubebuilder:validation:XValidation:rule="!has(self.action) || self.action != 'parallelism' || has(self.parallelism)",message="parallelism windows need a parallelism"
+// +kubebuilder:validation:XValidation:rule="!has(self.action) || self.action != 'patch' || has(self.patch)",message="patch windows need a patch"
+// +kubebuilder:validation:XValidation:rule="!has(self.action) || self.action != 'manifests' || has(self.manifests)",message="manifests windows need manifests"
+// +kubebuilder:validation:XValidation:rule="!has(self.action) || self.action != 'nodeMaintenance' || has(self.nodeMaintenance)",message="nodeMaintenance windows need nodeMaintenance"
+// +kubebuilder:validation:XValidation:rule="!has(self.action) || self.action != 'quota' || has(self.quotas)",message="quota windows need quotas"
+// +kubebuilder:validation:XValidation:rule="!has(self.action) || self.action != 'trafficShift' || has(self.trafficShift)",message="trafficShift windows need a trafficShift"
+// +kubebuilder:validation:XValidation:rule="!has(self.horizontalPodAutoscaler) || !has(self.horizontalPodAutoscaler.minReplicas) || self.horizontalPodAutoscaler.minReplicas >= 1",message="the autoscaler of a window needs a minReplicas of at least 1"
+type ScalingWindow struct {
+	// Name identifies the window in the status, it must be unique in the policy
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Start is the cron expression on which the window opens.
+	// +kubebuilder:validation:Pattern=`^(@(yearly|annually|monthly|weekly|daily|midnight|hourly)|@every [0-9a-z.]+|\S+( +\S+){4})$`
+	Start string `json:"start"`
+	// End is the cron expression on which the window closes.
+	// +kubebuilder:validation:Pattern=`^(@(yearly|annually|monthly|weekly|daily|midnight|hourly)|@every [0-9a-z.]+|\S+( +\S+){4})$`
+	End string `json:"end,omitempty"`
+	// Duration is how long the window stays open, such as 90m.
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// Lead makes the window open ahead of its start. It still closes at
+	// its end.
+	Lead `json:",inline"`
+	// Action is what the window does to the target, ScaleWindow when unset.
+	// Only scale and traffic shift windows take part in choosing the scale
+	// of the target, the fields below that are about replicas are ignored by
+	// the others.
+	Action WindowAction `json:"action,omitempty"`
+	// Replicas is the scale of the target while the window is open.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+	// ReplicasAfter is the scale the target returns to once the window has
+	// closed. The target is left as it is when it is not set.
+	// +kubebuilder:validation:Minimum=0
+	ReplicasAfter *int32 `json:"replicasAfter,omitempty"`
+	// Restore returns the target to the scale it had before the window
+	// opened once it has closed. It wins over ReplicasAfter.
+	Restore bool `json:"restore,omitempty"`
+	// HorizontalPodAutoscaler are the bounds the autoscaler of the target,
+	// if it has one, gets while the window is open. The minimum defaults to
+	// Replicas and the maximum to the larger of the minimum and the maximum
+	// the autoscaler had, the CPU utilization target is kept when unset.
+	HorizontalPodAutoscaler *HorizontalPodAutoscalerBounds `json:"horizontalPodAutoscaler,omitempty"`
+	// Resources are the compute resources ResourcesWindow gives the named
+	// containers while the window is open, within the bounds the
+	// LimitRanges of the namespace set.
+	Resources []ContainerResources `json:"resources,omitempty"`
+	// Suspend is whether SuspendWindow suspends the CronJob while the
+	// window is open, true when unset.
+	Suspend *bool `json:"suspend,omitempty"`
+	// Parallelism is the parallelism ParallelismWindow gives the Job while
+	// the window is open.
+	// +kubebuilder:validation:Minimum=0
+	Parallelism *int32 `json:"parallelism,omitempty"`
+	// Patch is the patch PatchWindow applies.
+	Patch *WindowPatch `json:"patch,omitempty"`
+	// Manifests are the objects ManifestsWindow creates. Namespaced objects
+	// are created in the namespace of the policy.
+	// +kubebuilder:validation:items:EmbeddedResource
+	Manifests []runtime.RawExtension `json:"manifests,omitempty"`
+	// NodeMaintenance are the nodes NodeMaintenanceWindow takes into
+	// maintenance and how.
+	NodeMaintenance *NodeMaintenance `json:"nodeMaintenance,omitempty"`
+	// Quotas are the limits QuotaWindow gives the named ResourceQuotas.
+	// Limits the namespace already uses more of are only lowered once its
+	// usage allows.
+	Quotas []QuotaLimits `json:"quotas,omitempty"`
+	// TrafficShift is how TrafficShiftWindow sends traffic to the target.
+	TrafficShift *TrafficShift `json:"trafficShift,omitempty"`
+}
+
+// DefaultWeightAnnotation is the annotation of an Ingress a traffic shift
+// sets the weight in when it names none, the canary weight of the NGINX
+// ingress controller.
+const DefaultWeightAnnotation = "nginx.ingress.kubernetes.io/canary-weight"
+
+// TrafficShift moves traffic to the target of a window, either by switching
+// the selector of a Service to its pods or by setting the weight of an
+// Ingress that routes to it. Exactly one of Service and Ingress is set.
+// +kubebuilder:validation:XValidation:rule="has(self.service) != has(self.ingress)",message="exactly one of service and ingress must be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.service) || has(self.selector)",message="a service needs a selector"
+// +kubebuilder:validation:XValidation:rule="!has(self.ingress) || has(self.weight)",message="an ingress needs a weight"
+type TrafficShift struct {
+	// Service is the Service whose selector is set to Selector.
+	Service  string            `json:"service,omitempty"`
+	Selector map[string]string `json:"selector,omitempty"`
+	// Ingress is the Ingress whose WeightAnnotation is set to Weight.
+	Ingress string `json:"ingress,omitempty"`
+	// WeightAnnotation is the annotation holding the weight,
+	// DefaultWeightAnnotation when unset.
+	WeightAnnotation string `json:"weightAnnotation,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	Weight *int32 `json:"weight,omitempty"`
+}
+
+// QuotaLimits are hard limits of the named ResourceQuota.
+type QuotaLimits struct {
+	// +kubebuilder:validation:MinLength=1
+	Name string              `json:"name"`
+	Hard corev1.ResourceList `json:"hard"`
+}
+
+// NodeMaintenance selects the nodes a maintenance window or rule cordons and
+// taints.
+type NodeMaintenance struct {
+	Selector metav1.LabelSelector `json:"selector"`
+	// Taints are added to the nodes while they are in maintenance, besides
+	// cordoning them.
+	Taints []corev1.Taint `json:"taints,omitempty"`
+	// MaxUnavailable is how many of the selected nodes may be unavailable at
+	// once, a number or a percentage of them rounded down, one when unset.
+	// Nodes that are cordoned or not ready for any reason count. Nodes
+	// wait their turn when the limit is reached.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// NodeDuration is how long each node stays in maintenance before it is
+	// restored and the next one can take its turn. When it is not set, the
+	// nodes of a window stay in maintenance until the window closes; rules
+	// need it.
+	NodeDuration *metav1.Duration `json:"nodeDuration,omitempty"`
+}
+
+// PatchType is the format of a patch
+// +kubebuilder:validation:Enum=merge;json
+type PatchType string
+
+const (
+	// MergePatch is a JSON merge patch, RFC 7386
+	MergePatch PatchType = "merge"
+	// JSONPatch is a JSON patch, RFC 6902
+	JSONPatch PatchType = "json"
+)
+
+// WindowPatch is the patch a window applies to the target once each time it
+// opens, and the one that reverts it when it closes. Patches are written in
+// JSON or YAML.
+type WindowPatch struct {
+	// Type is the format of both patches, MergePatch when unset.
+	Type PatchType `json:"type,omitempty"`
+	// Apply is applied when the window opens.
+	// +kubebuilder:validation:MinLength=1
+	Apply string `json:"apply"`
+	// Revert, if set, is applied when the window closes.
+	Revert string `json:"revert,omitempty"`
+}
+
+// ContainerResources are the compute resources of one container of a pod
+// template.
+type ContainerResources struct {
+	// Name is the name of the container.
+	Name string `json:"name"`
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources"`
+}
+
+// HorizontalPodAutoscalerBounds are the bounds and the CPU utilization target
+// of a HorizontalPodAutoscaler.
+type HorizontalPodAutoscalerBounds struct {
+	// +kubebuilder:validation:Minimum=0
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+}
+
+// AppliedManifests are the objects the manifests of an open window created.
+type AppliedManifests struct {
+	Window  string                                    `json:"window"`
+	Objects []autoscaling.CrossVersionObjectReference `json:"objects,omitempty"`
+}
+
+// NodePhase is where a node is in a maintenance window
+type NodePhase string
+
+const (
+	// NodePending is a node waiting for fewer nodes to be unavailable
+	NodePending NodePhase = "Pending"
+	// NodeInMaintenance is a node the window has cordoned and tainted
+	NodeInMaintenance NodePhase = "InMaintenance"
+	// NodeDone is a node that has been restored after its maintenance while
+	// the window is still open
+	NodeDone NodePhase = "Done"
+)
+
+// MaintainedNode is the state of one of the nodes of a maintenance window.
+type MaintainedNode struct {
+	Name  string    `json:"name"`
+	Phase NodePhase `json:"phase"`
+	// LastTransitionTime is when the node entered its phase.
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Unschedulable is set when the node was cordoned already before its
+	// maintenance, it is left cordoned then.
+	Unschedulable bool `json:"unschedulable,omitempty"`
+	// Taints are the taints the maintenance added to the node, which are
+	// removed again.
+	Taints []corev1.Taint `json:"taints,omitempty"`
+}
+
+// NodeMaintenanceStatus is the state of the nodes of an open maintenance
+// window, or of the run a maintenance rule started. Exactly one of Window
+// and Rule is set.
+type NodeMaintenanceStatus struct {
+	Window string           `json:"window,omitempty"`
+	Rule   string           `json:"rule,omitempty"`
+	Nodes  []MaintainedNode `json:"nodes,omitempty"`
+}
+
+// AppliedTrafficShift is a traffic shift a window made, with what it takes
+// to move the traffic back. Until Time is set the shift waits for the target
+// to be ready, and Message tells what for.
+type AppliedTrafficShift struct {
+	TrafficShift `json:",inline"`
+	// OriginalSelector is the selector the Service had before the shift.
+	OriginalSelector map[string]string `json:"originalSelector,omitempty"`
+	// OriginalWeight is the weight the Ingress had before the shift, unset
+	// when it had none.
+	OriginalWeight *string `json:"originalWeight,omitempty"`
+	// Time is when the traffic was shifted.
+	Time    *metav1.Time `json:"time,omitempty"`
+	Message string       `json:"message,omitempty"`
+}
+
+// AppliedQuota is a ResourceQuota a window changed, with the limits it had
+// before.
+type AppliedQuota struct {
+	Name string `json:"name"`
+	// Hard are the limits the window changed, as they were before.
+	Hard corev1.ResourceList `json:"hard,omitempty"`
+	// Unset are the resources the window limits that the quota did not
+	// limit before.
+	Unset []corev1.ResourceName `json:"unset,omitempty"`
+	// Deferred tells which limits are not lowered yet because the namespace
+	// uses more than they allow.
+	Deferred string `json:"deferred,omitempty"`
+}
+
+// AppliedQuotas are the ResourceQuotas an open window changed.
+type AppliedQuotas struct {
+	Window string         `json:"window"`
+	Quotas []AppliedQuota `json:"quotas,omitempty"`
+}
+
+// TargetSelector selects the objects of one kind in the namespace of the
+// policy by label.
+type TargetSelector struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	// +kubebuilder:validation:MinLength=1
+	Kind     string               `json:"kind"`
+	Selector metav1.LabelSelector `json:"selector"`
+}
+
+// PolicySpec define the spec of the policy. A policy scales either the
+// single object ScaleTargetRef names or every object TargetSelector matches.
+// A policy whose windows only create manifests, maintain nodes or change
+// quotas needs neither.
+// It holds either rules, which fire once on their schedule, or windows, which
+// hold the target at a scale for as long as they are open.
+// +kubebuilder:validation:XValidation:rule="!has(self.minReplicas) || !has(self.maxReplicas) || self.minReplicas <= self.maxReplicas",message="minReplicas must not be larger than maxReplicas"
+// +kubebuilder:validation:XValidation:rule="!has(self.scaleTargetRef) || !has(self.targetSelector)",message="only one of scaleTargetRef and targetSelector may be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.rules) || !has(self.windows)",message="only one of rules and windows may be set"
+// +kubebuilder:validation:XValidation:rule="has(self.rules) || has(self.windows) || has(self.overrides)",message="a policy needs rules, windows or overrides"
+// +kubebuilder:validation:XValidation:rule="has(self.scaleTargetRef) || has(self.targetSelector) || (!has(self.rules) || self.rules.all(r, r.action == 'nodeMaintenance')) && (!has(self.windows) || self.windows.all(w, has(w.action) && w.action in ['manifests', 'nodeMaintenance', 'quota']))",message="rules and windows that act on a target need a scaleTargetRef or a targetSelector"
+type PolicySpec struct {
+	ScaleTargetRef *autoscaling.CrossVersionObjectReference `json:"scaleTargetRef,omitempty"`
+	TargetSelector *TargetSelector                          `json:"targetSelector,omitempty"`
+	// +kubebuilder:validation:MinItems=1
+	// +listType=map
+	// +listMapKey=name
+	Rules []PolicyRule `json:"rules,omitempty"`
+	// +kubebuilder:validation:MinItems=1
+	// +listType=map
+	// +listMapKey=name
+	Windows []ScalingWindow `json:"windows,omitempty"`
+	// MinReplicas and MaxReplicas bound every scale the rules and windows
+	// of the policy ask for.
+	// +kubebuilder:validation:Minimum=0
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+	// Strategy combines this policy with the other policies of the same
+	// target. Policies that set it must agree, StrategyMax is used when
+	// none does.
+	Strategy Strategy `json:"strategy,omitempty"`
+	// Priority ranks the policy under StrategyPriority, higher wins.
+	Priority int32 `json:"priority,omitempty"`
+	// Overrides names the cluster policies this policy replaces in its
+	// namespace. A policy made only of overrides opts the namespace out of
+	// them.
+	// +kubebuilder:validation:MinItems=1
+	// +listType=set
+	// +kubebuilder:validation:items:MinLength=1
+	Overrides []string `json:"overrides,omitempty"`
+	// TimeZone is the IANA name of the time zone the schedules are evaluated
+	// in, such as "Europe/Berlin". The controller's local time zone is used
+	// when it is empty. Around daylight saving changes a schedule that falls
+	// in the skipped hour runs when the clocks have gone forward, and one
+	// that falls in the repeated hour runs only the first time round.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// RuleStatus is the execution state of a single rule
+type RuleStatus struct {
+	Name string `json:"name"`
+	// LastScheduleTime is the most recent schedule time of the rule that was handled.
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// NextScheduleTime is the next time the rule will fire.
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+	// Skipped tells why the most recent schedule time of the rule did not
+	// change the scale of the target, empty when it did.
+	Skipped    string `json:"skipped,omitempty"`
+	LeadStatus `json:",inline"`
+}
+
+// LeadStatus is how far ahead of its schedule a rule or window acts, and
+// when the capacity it asked for was ready.
+type LeadStatus struct {
+	// LeadTime is how long ahead of its schedule the rule or window acts,
+	// as set or learned.
+	LeadTime *metav1.Duration `json:"leadTime,omitempty"`
+	// Capacity is how the most recent run that scaled the target went.
+	Capacity *CapacityStatus `json:"capacity,omitempty"`
+	// ReadyLatencies are how long the pods of the target took to become
+	// ready in the recent runs, oldest first. LearnLeadTime learns from them.
+	ReadyLatencies []metav1.Duration `json:"readyLatencies,omitempty"`
+}
+
+// CapacityStatus is when the capacity a run of a rule or window asked for
+// was ready, compared with when it was asked for.
+type CapacityStatus struct {
+	// RequestedTime is the schedule time of the run.
+	RequestedTime *metav1.Time `json:"requestedTime,omitempty"`
+	// TriggerTime is when the controller scaled the target for it.
+	TriggerTime *metav1.Time `json:"triggerTime,omitempty"`
+	// Replicas is the number of ready pods the run waits for.
+	Replicas int32 `json:"replicas"`
+	// ReadyTime is when that many pods of the target were ready, unset
+	// while they are not.
+	ReadyTime *metav1.Time `json:"readyTime,omitempty"`
+	// Late is how long after RequestedTime the capacity was ready, negative
+	// when it was ready ahead of it.
+	Late *metav1.Duration `json:"late,omitempty"`
+}
+
+// WindowStatus is the state of a single window
+type WindowStatus struct {
+	Name   string `json:"name"`
+	Active bool   `json:"active"`
+	// StartTime and EndTime bound the current occurrence of the window, or
+	// the most recent one when it is not active.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	EndTime   *metav1.Time `json:"endTime,omitempty"`
+	// NextStartTime is the next time the window opens.
+	NextStartTime *metav1.Time `json:"nextStartTime,omitempty"`
+	LeadStatus    `json:",inline"`
+}
+
+// AppliedWindow is a window other than a scale window whose change to the
+// target is in place, with what it takes to undo it once the window closes.
+type AppliedWindow struct {
+	Name string `json:"name"`
+	// Resources are the compute resources the containers of the target had
+	// before the window opened.
+	Resources []ContainerResources `json:"resources,omitempty"`
+	// Suspend is whether the CronJob was suspended before the window opened.
+	Suspend *bool `json:"suspend,omitempty"`
+	// Parallelism is the parallelism the Job had before the window opened.
+	Parallelism *int32 `json:"parallelism,omitempty"`
+	// Patch is the patch the window applied.
+	Patch *AppliedPatch `json:"patch,omitempty"`
+	// TrafficShift is the traffic shift the window made or waits to make.
+	TrafficShift *AppliedTrafficShift `json:"trafficShift,omitempty"`
+}
+
+// AppliedPatch is a patch a window applied to the target and its result.
+type AppliedPatch struct {
+	WindowPatch `json:",inline"`
+	// Time is when the patch was applied.
+	Time *metav1.Time `json:"time,omitempty"`
+	// ResourceVersion is the resource version of the target the patch
+	// produced.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// Error is why the patch could not be applied. It is tried again on
+	// every pass while the window is open.
+	Error string `json:"error,omitempty"`
+}
+
+// RolloutPhase is how far the rollout started by a restart rule has come
+type RolloutPhase string
+
+const (
+	// RolloutProgressing is a rollout that has not completed yet
+	RolloutProgressing RolloutPhase = "Progressing"
+	// RolloutComplete is a rollout all of whose pods are updated and
+	// available
+	RolloutComplete RolloutPhase = "Complete"
+	// RolloutFailed is a rollout that did not complete in time
+	RolloutFailed RolloutPhase = "Failed"
+)
+
+// RolloutStatus is the state of the rollout the last restart rule of the
+// policy started on the target.
+type RolloutStatus struct {
+	// Rule is the name of the restart rule that started the rollout.
+	Rule  string       `json:"rule"`
+	Phase RolloutPhase `json:"phase"`
+	// Generation is the generation of the target the restart produced.
+	Generation int64 `json:"generation,omitempty"`
+	// StartTime is when the rollout was started, CompletionTime when it
+	// completed or failed.
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message tells how far the rollout has come, or why it failed.
+	Message string `json:"message,omitempty"`
+}
+
+// TargetStatus is the state of one of the objects a TargetSelector matches.
+// Its fields mean the same as the ones of PolicyStatus for a single target.
+type TargetStatus struct {
+	Name             string `json:"name"`
+	DesiredReplicas  *int32 `json:"desiredReplicas,omitempty"`
+	BaselineReplicas *int32 `json:"baselineReplicas,omitempty"`
+	AppliedReplicas  *int32 `json:"appliedReplicas,omitempty"`
+	OriginalReplicas *int32 `json:"originalReplicas,omitempty"`
+	// OriginalHorizontalPodAutoscaler are the bounds the autoscaler of the
+	// target had before the policy first changed them.
+	OriginalHorizontalPodAutoscaler *HorizontalPodAutoscalerBounds `json:"originalHorizontalPodAutoscaler,omitempty"`
+	AppliedWindows                  []AppliedWindow                `json:"appliedWindows,omitempty"`
+	Rollout                         *RolloutStatus                 `json:"rollout,omitempty"`
+	// Error is why the target could not be scaled on the last attempt.
+	Error string `json:"error,omitempty"`
+}
+
+// PolicyStatus show the current status of policy
+type PolicyStatus struct {
+	// LastScheduleTime is the most recent schedule time handled by any rule.
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// NextScheduleTime is the next time any rule fires or any window opens
+	// or closes.
+	NextScheduleTime *metav1.Time   `json:"nextScheduleTime,omitempty"`
+	Rules            []RuleStatus   `json:"rules,omitempty"`
+	Windows          []WindowStatus `json:"windows,omitempty"`
+	// BaselineReplicas is the scale ScaleByPercent rules are measured
+	// against. It is captured from the target when such a rule fires and
+	// there is none yet, or the target has been scaled by something else
+	// than the rules of the policy since.
+	BaselineReplicas *int32 `json:"baselineReplicas,omitempty"`
+	// AppliedReplicas is the scale a rule of the policy last set the target
+	// to.
+	AppliedReplicas *int32 `json:"appliedReplicas,omitempty"`
+	// OriginalReplicas is the scale the target had before the policy first
+	// changed it, which Restore returns it to. It is cleared once restored,
+	// or once every window of the policy has closed.
+	OriginalReplicas *int32 `json:"originalReplicas,omitempty"`
+	// OriginalHorizontalPodAutoscaler are the bounds the autoscaler of the
+	// target had before the policy first changed them. When the target has
+	// an autoscaler, rules and windows change its bounds instead of the
+	// scale of the target, and Restore and closing windows put these back.
+	OriginalHorizontalPodAutoscaler *HorizontalPodAutoscalerBounds `json:"originalHorizontalPodAutoscaler,omitempty"`
+	// AppliedWindows are the windows whose change to the target is in
+	// place. A window stays here until its change has been undone, even if
+	// it is removed from the spec in the meantime.
+	AppliedWindows []AppliedWindow `json:"appliedWindows,omitempty"`
+	// Rollout is the state of the rollout the last restart rule started.
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+	// Manifests are the objects created by the manifests of open windows.
+	// They are kept here until deleted, even if their window is removed
+	// from the spec in the meantime.
+	Manifests []AppliedManifests `json:"manifests,omitempty"`
+	// NodeMaintenance is the state of the nodes of open maintenance windows
+	// and of running maintenance rules. Nodes are kept here until restored,
+	// even if their window or rule is removed from the spec in the meantime.
+	NodeMaintenance []NodeMaintenanceStatus `json:"nodeMaintenance,omitempty"`
+	// Quotas are the ResourceQuotas open windows changed. They are kept
+	// here until restored, even if their window is removed from the spec in
+	// the meantime.
+	Quotas []AppliedQuotas `json:"quotas,omitempty"`
+	// DesiredReplicas is the scale the windows of all policies of the target
+	// currently ask for once combined, if any.
+	DesiredReplicas *int32 `json:"desiredReplicas,omitempty"`
+	// Targets is the state of every object the TargetSelector matches, the
+	// replica fields above are only used with a ScaleTargetRef.
+	Targets []TargetStatus `json:"targets,omitempty"`
+}
+
+// Rule returns the named rule, or nil if there is none.
+func (s *PolicySpec) Rule(name string) *PolicyRule {
+	for i := range s.Rules {
+		if s.Rules[i].Name == name {
+			return &s.Rules[i]
+		}
+	}
+	return nil
+}
+
+// RuleStatus returns the status of the named rule, or nil if it has none yet.
+func (s *PolicyStatus) RuleStatus(name string) *RuleStatus {
+	for i := range s.Rules {
+		if s.Rules[i].Name == name {
+			return &s.Rules[i]
+		}
+	}
+	return nil
+}
+
+// WindowStatus returns the status of the named window, or nil if it has
+// none yet.
+func (s *PolicyStatus) WindowStatus(name string) *WindowStatus {
+	for i := range s.Windows {
+		if s.Windows[i].Name == name {
+			return &s.Windows[i]
+		}
+	}
+	return nil
+}
+
+// AppliedWindow returns the named applied window, or nil if it is not applied.
+func (s *PolicyStatus) AppliedWindow(name string) *AppliedWindow {
+	for i := range s.AppliedWindows {
+		if s.AppliedWindows[i].Name == name {
+			return &s.AppliedWindows[i]
+		}
+	}
+	return nil
+}
+
+// AppliedManifests returns the objects the named window created, or nil if
+// it has created none.
+func (s *PolicyStatus) AppliedManifests(window string) *AppliedManifests {
+	for i := range s.Manifests {
+		if s.Manifests[i].Window == window {
+			return &s.Manifests[i]
+		}
+	}
+	return nil
+}
+
+// NodeMaintenanceStatus returns the state of the nodes of the named window,
+// or nil if it has none.
+func (s *PolicyStatus) NodeMaintenanceStatus(window string) *NodeMaintenanceStatus {
+	for i := range s.NodeMaintenance {
+		if s.NodeMaintenance[i].Window == window {
+			return &s.NodeMaintenance[i]
+		}
+	}
+	return nil
+}
+
+// NodeMaintenanceRun returns the state of the nodes of the run the named
+// rule started, or nil if none is running.
+func (s *PolicyStatus) NodeMaintenanceRun(rule string) *NodeMaintenanceStatus {
+	for i := range s.NodeMaintenance {
+		if s.NodeMaintenance[i].Rule == rule {
+			return &s.NodeMaintenance[i]
+		}
+	}
+	return nil
+}
+
+// AppliedQuotas returns the ResourceQuotas the named window changed, or nil
+// if it has changed none.
+func (s *PolicyStatus) AppliedQuotas(window string) *AppliedQuotas {
+	for i := range s.Quotas {
+		if s.Quotas[i].Window == window {
+			return &s.Quotas[i]
+		}
+	}
+	return nil
+}
+
+// TargetStatus returns the status of the named target, or nil if it has none yet.
+func (s *PolicyStatus) TargetStatus(name string) *TargetStatus {
+	for i := range s.Targets {
+		if s.Targets[i].Name == name {
+			return &s.Targets[i]
+		}
+	}
+	return nil
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Policy is a set of time based rules that change the scale of one target.
+type Policy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              PolicySpec   `json:"spec"`
+	Status            PolicyStatus `json:"status,omitempty"`
+}
+
+// Hub marks this version as the one every other version converts through.
+func (*Policy) Hub() {}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// PolicyList is a list of Policies.
+type PolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Policy `json:"items"`
+}
+
+// ClusterPolicySpec is a policy spec applied in every namespace the
+// NamespaceSelector matches. Its target is resolved in each of them.
+// +kubebuilder:validation:XValidation:rule="has(self.scaleTargetRef) || has(self.targetSelector)",message="a cluster policy needs a scaleTargetRef or a targetSelector"
+// +kubebuilder:validation:XValidation:rule="has(self.rules) || has(self.windows)",message="a cluster policy needs rules or windows"
+// +kubebuilder:validation:XValidation:rule="!has(self.overrides)",message="only policies have overrides"
+// +kubebuilder:validation:XValidation:rule="!has(self.windows) || self.windows.all(w, !has(w.action) || w.action != 'nodeMaintenance')",message="node maintenance is not available in cluster policies"
+// +kubebuilder:validation:XValidation:rule="!has(self.rules) || self.rules.all(r, r.action != 'nodeMaintenance')",message="node maintenance is not available in cluster policies"
+type ClusterPolicySpec struct {
+	PolicySpec `json:",inline"`
+	// NamespaceSelector selects the namespaces the policy applies in by
+	// label.
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+}
+
+// ClusterPolicyPrefix starts the name of the Policy a cluster policy keeps
+// its state in, in each namespace it applies to. The rest is the name of the
+// cluster policy.
+const ClusterPolicyPrefix = "clusterpolicy."
+
+// NamespaceStatus sums up the state of a cluster policy in one namespace.
+// The full state, the status a Policy with the same spec would have there,
+// is kept in the status of the Policy named Policy in the namespace, which
+// the cluster policy controls.
+type NamespaceStatus struct {
+	Name string `json:"name"`
+	// Since is when the cluster policy started to apply to the namespace,
+	// its schedules are not caught up on before that.
+	Since *metav1.Time `json:"since,omitempty"`
+	// Policy is the name of the Policy holding the full state.
+	Policy string `json:"policy,omitempty"`
+	// ActiveWindows lists the windows open in the namespace.
+	ActiveWindows []string `json:"activeWindows,omitempty"`
+	// Applied is set while windows have changes recorded in the namespace
+	// that are undone once the cluster policy stops applying there.
+	Applied bool `json:"applied,omitempty"`
+	// Releasing is set once the cluster policy no longer applies to the
+	// namespace, until what its windows changed there is undone.
+	Releasing bool `json:"releasing,omitempty"`
+}
+
+// ClusterPolicyStatus is the state of a cluster policy in every namespace it
+// applies to.
+type ClusterPolicyStatus struct {
+	Namespaces []NamespaceStatus `json:"namespaces,omitempty"`
+	// Overridden lists the matching namespaces where a Policy overrides the
+	// cluster policy.
+	Overridden []string `json:"overridden,omitempty"`
+}
+
+// NamespaceStatus returns the status of the named namespace, or nil if it has none yet.
+func (s *ClusterPolicyStatus) NamespaceStatus(name string) *NamespaceStatus {
+	for i := range s.Namespaces {
+		if s.Namespaces[i].Name == name {
+			return &s.Namespaces[i]
+		}
+	}
+	return nil
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterPolicy applies the same policy in every namespace its selector
+// matches. A Policy that lists it in its overrides replaces it in the
+// namespace of the Policy.
+type ClusterPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              ClusterPolicySpec   `json:"spec"`
+	Status            ClusterPolicyStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterPolicyList is a list of ClusterPolicies.
+type ClusterPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterPolicy `json:"items"`
+}
+
+// HibernationSpec sets when a namespace sleeps. The namespace is asleep from
+// every activation of Sleep until the next activation of Wake.
+type HibernationSpec struct {
+	// Sleep is the cron schedule on which the namespace is put to sleep.
+	// +kubebuilder:validation:Pattern=`^(@(yearly|annually|monthly|weekly|daily|midnight|hourly)|@every [0-9a-z.]+|\S+( +\S+){4})$`
+	Sleep string `json:"sleep"`
+	// Wake is the cron schedule on which the namespace is woken up.
+	// +kubebuilder:validation:Pattern=`^(@(yearly|annually|monthly|weekly|daily|midnight|hourly)|@every [0-9a-z.]+|\S+( +\S+){4})$`
+	Wake string `json:"wake"`
+	// TimeZone is the IANA name of the time zone the schedules are
+	// evaluated in, the controller's local time zone when empty.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`
+	TimeZone string `json:"timeZone,omitempty"`
+	// Activator, if set, wakes workloads up when their Services are
+	// requested while the namespace sleeps.
+	Activator *HibernationActivator `json:"activator,omitempty"`
+}
+
+// HibernationActivator routes Services to the activator of the controller
+// while their namespace sleeps. A request to one of them scales its workload
+// up and is forwarded once the workload is ready, and the Service is handed
+// back to its pods. IdleTimeout after that, the workload goes back to sleep
+// and the Service is routed to the activator again.
+type HibernationActivator struct {
+	// +kubebuilder:validation:MinItems=1
+	// +listType=map
+	// +listMapKey=name
+	Services []ActivatedService `json:"services"`
+	// IdleTimeout is how long a workload woken up by a request stays up,
+	// ten minutes when unset.
+	IdleTimeout *metav1.Duration `json:"idleTimeout,omitempty"`
+}
+
+// ActivatedService is a Service and the workload behind it.
+type ActivatedService struct {
+	// Name is the name of the Service.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// ScaleTargetRef is the workload a request to the Service wakes up.
+	ScaleTargetRef autoscaling.CrossVersionObjectReference `json:"scaleTargetRef"`
+}
+
+// HibernatedWorkload is a workload scaled to zero by a hibernation, with the
+// scale it is restored to at wake time.
+type HibernatedWorkload struct {
+	autoscaling.CrossVersionObjectReference `json:",inline"`
+	Replicas                                int32 `json:"replicas"`
+}
+
+// WokenService is a Service whose workload a request woke up while its
+// namespace sleeps.
+type WokenService struct {
+	// Name is the name of the Service.
+	Name string `json:"name"`
+	// ScaleTargetRef is the workload that was woken up.
+	ScaleTargetRef autoscaling.CrossVersionObjectReference `json:"scaleTargetRef"`
+	// WakeTime is when the Service was handed back to its pods.
+	WakeTime metav1.Time `json:"wakeTime"`
+}
+
+// HibernationStatus is the state of a hibernation.
+type HibernationStatus struct {
+	// Asleep is set while the namespace sleeps.
+	Asleep bool `json:"asleep,omitempty"`
+	// LastSleepTime and LastWakeTime are the most recent activations of the
+	// sleep and wake schedules.
+	LastSleepTime *metav1.Time `json:"lastSleepTime,omitempty"`
+	LastWakeTime  *metav1.Time `json:"lastWakeTime,omitempty"`
+	// NextScheduleTime is when the namespace next falls asleep or wakes up.
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+	// Workloads are the workloads scaled to zero and their original scale.
+	Workloads []HibernatedWorkload `json:"workloads,omitempty"`
+	// Autoscaled are the workloads left running because a
+	// HorizontalPodAutoscaler scales them, which cannot scale them to zero.
+	Autoscaled []autoscaling.CrossVersionObjectReference `json:"autoscaled,omitempty"`
+	// CronJobs are the names of the CronJobs suspended by the hibernation.
+	// CronJobs that were suspended already are left alone.
+	CronJobs []string `json:"cronJobs,omitempty"`
+	// Services are the names of the Services routed to the activator.
+	Services []string `json:"services,omitempty"`
+	// Woken are the Services handed back to their pods after a request woke
+	// their workload up. They are routed to the activator again once the
+	// idle timeout has passed.
+	// +listType=map
+	// +listMapKey=name
+	Woken []WokenService `json:"woken,omitempty"`
+	// UnroutedPorts are the ports of those Services, as service/port, that
+	// are not routed to the activator because they do not carry HTTP. They
+	// have no endpoints while the namespace sleeps.
+	UnroutedPorts []string `json:"unroutedPorts,omitempty"`
+	// Error is why the last attempt to put the namespace to sleep or to wake
+	// it up failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// WokenService returns the woken Service of the given name, or nil if there
+// is none.
+func (s *HibernationStatus) WokenService(name string) *WokenService {
+	for i := range s.Woken {
+		if s.Woken[i].Name == name {
+			return &s.Woken[i]
+		}
+	}
+	return nil
+}
+
+// Workload returns the hibernated workload ref points at, or nil if there is
+// none.
+func (s *HibernationStatus) Workload(ref autoscaling.CrossVersionObjectReference) *HibernatedWorkload {
+	for i := range s.Workloads {
+		if s.Workloads[i].CrossVersionObjectReference == ref {
+			return &s.Workloads[i]
+		}
+	}
+	return nil
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Hibernation scales every workload in its namespace to zero and suspends
+// its CronJobs on a schedule, and restores them on another.
+type Hibernation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              HibernationSpec   `json:"spec"`
+	Status            HibernationStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// HibernationList is a list of Hibernations.
+type HibernationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Hibernation `json:"items"`
+}
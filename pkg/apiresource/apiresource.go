@@ -0,0 +1,234 @@
+// Package apiresource finds the resources the apiserver serves through its
+// discovery API, and keeps them until a request shows that one is no longer
+// served, for example because a CustomResourceDefinition was removed.
+package apiresource
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+// Resource is a resource found through discovery.
+type Resource struct {
+	GroupVersion schema.GroupVersion
+	Kind         string
+	// Name is the plural name of the resource in its path.
+	Name       string
+	Namespaced bool
+	// Subresources are the names of the subresources it serves, such as
+	// scale or status.
+	Subresources []string
+}
+
+// Path returns the path of the collection of r, in namespace if r is
+// namespaced.
+func (r Resource) Path(namespace string) string {
+	prefix := "/api"
+	if r.GroupVersion.Group != "" {
+		prefix = path.Join("/apis", r.GroupVersion.Group)
+	}
+	if !r.Namespaced {
+		return path.Join(prefix, r.GroupVersion.Version, r.Name)
+	}
+	return path.Join(prefix, r.GroupVersion.Version, "namespaces", namespace, r.Name)
+}
+
+// HasSubresource reports whether r serves the named subresource.
+func (r Resource) HasSubresource(name string) bool {
+	for _, sub := range r.Subresources {
+		if sub == name {
+			return true
+		}
+	}
+	return false
+}
+
+// notServedError is returned when the apiserver serves no resource a
+// Resolver accepts of the kind asked for.
+type notServedError struct {
+	message string
+}
+
+func (e *notServedError) Error() string {
+	return e.message
+}
+
+// IsNotServed reports whether err says that the apiserver serves no resource
+// of the kind asked for.
+func IsNotServed(err error) bool {
+	_, ok := err.(*notServedError)
+	return ok
+}
+
+// Resolver finds the resources of kinds through discovery and caches them.
+type Resolver struct {
+	discovery discovery.DiscoveryInterface
+	accept    func(Resource) bool
+	// description says what the accepted resources have in common, in the
+	// errors of kinds that are served without it.
+	description string
+
+	lock      sync.Mutex
+	resources map[string]Resource
+	preferred []Resource
+}
+
+// NewResolver returns a Resolver that only finds the resources accept is true
+// for, all of them if it is nil. description, such as "with a scale
+// subresource", says what they have in common.
+func NewResolver(d discovery.DiscoveryInterface, accept func(Resource) bool, description string) *Resolver {
+	return &Resolver{
+		discovery:   d,
+		accept:      accept,
+		description: description,
+		resources:   map[string]Resource{},
+	}
+}
+
+// Resolve finds the resource of kind, in apiVersion or, when it is empty, in
+// the preferred version of any group.
+func (r *Resolver) Resolve(apiVersion, kind string) (Resource, error) {
+	if apiVersion == "" {
+		return r.ResolveFirst(nil, kind)
+	}
+	return r.ResolveFirst([]string{apiVersion}, kind)
+}
+
+// ResolveFirst finds the resource of kind in the first of versions that
+// serves it or, when versions is empty, in the preferred version of any
+// group.
+func (r *Resolver) ResolveFirst(versions []string, kind string) (Resource, error) {
+	key := strings.Join(versions, ",") + "/" + kind
+	r.lock.Lock()
+	res, ok := r.resources[key]
+	r.lock.Unlock()
+	if ok {
+		return res, nil
+	}
+
+	var candidates []Resource
+	if len(versions) == 0 {
+		preferred, err := r.Preferred()
+		if err != nil {
+			return Resource{}, err
+		}
+		candidates = preferred
+	}
+	for _, v := range versions {
+		list, err := r.discovery.ServerResourcesForGroupVersion(v)
+		if errors.IsNotFound(err) && len(versions) > 1 {
+			continue
+		}
+		if err != nil {
+			return Resource{}, err
+		}
+		candidates = append(candidates, r.resourcesOf(list)...)
+	}
+
+	for _, c := range candidates {
+		if c.Kind != kind {
+			continue
+		}
+		r.lock.Lock()
+		r.resources[key] = c
+		r.lock.Unlock()
+		return c, nil
+	}
+	what := kind
+	if r.description != "" {
+		what += " " + r.description
+	}
+	switch {
+	case len(versions) == 0:
+		return Resource{}, &notServedError{fmt.Sprintf("no resource of kind %s is served", what)}
+	case len(versions) == 1:
+		return Resource{}, &notServedError{fmt.Sprintf("%s %s is not served", versions[0], what)}
+	}
+	return Resource{}, &notServedError{fmt.Sprintf("no resource of kind %s is served in %s", what, strings.Join(versions, ", "))}
+}
+
+// Preferred returns the accepted resources in the preferred version of each
+// group. A kind served by several groups, such as Deployments in apps and
+// extensions, is returned once per group.
+func (r *Resolver) Preferred() ([]Resource, error) {
+	r.lock.Lock()
+	preferred := r.preferred
+	r.lock.Unlock()
+	if preferred != nil {
+		return preferred, nil
+	}
+
+	lists, err := r.discovery.ServerPreferredResources()
+	if err != nil && len(lists) == 0 {
+		return nil, err
+	}
+	preferred = []Resource{}
+	for _, list := range lists {
+		preferred = append(preferred, r.resourcesOf(list)...)
+	}
+	r.lock.Lock()
+	r.preferred = preferred
+	r.lock.Unlock()
+	return preferred, nil
+}
+
+// Forget drops what was found when err says that a resource is no longer
+// served, so that it is looked up again. An object that is not found is not
+// a reason to.
+func (r *Resolver) Forget(err error) {
+	if !Gone(err) {
+		return
+	}
+	r.lock.Lock()
+	r.resources = map[string]Resource{}
+	r.preferred = nil
+	r.lock.Unlock()
+}
+
+// Gone reports whether err says that the resource requested is not served,
+// as opposed to a named object of it that does not exist. The apiserver
+// names the object in the details of the latter, while a path it does not
+// serve gets a NotFound without details.
+func Gone(err error) bool {
+	if !errors.IsNotFound(err) {
+		return false
+	}
+	status, ok := err.(errors.APIStatus)
+	if !ok {
+		return true
+	}
+	details := status.Status().Details
+	return details == nil || details.Name == ""
+}
+
+// resourcesOf returns the accepted resources of list, with their
+// subresources.
+func (r *Resolver) resourcesOf(list *metav1.APIResourceList) []Resource {
+	gv, err := schema.ParseGroupVersion(list.GroupVersion)
+	if err != nil {
+		return nil
+	}
+	var resources []Resource
+	for _, ar := range list.APIResources {
+		if path.Dir(ar.Name) != "." {
+			continue
+		}
+		res := Resource{GroupVersion: gv, Kind: ar.Kind, Name: ar.Name, Namespaced: ar.Namespaced}
+		for _, sub := range list.APIResources {
+			if path.Dir(sub.Name) == ar.Name {
+				res.Subresources = append(res.Subresources, path.Base(sub.Name))
+			}
+		}
+		if r.accept == nil || r.accept(res) {
+			resources = append(resources, res)
+		}
+	}
+	return resources
+}
@@ -11,6 +11,7 @@ import (
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 
 	policyapi "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1"
+	"github.com/hchenxa/timebase/pkg/client/clientset/versioned"
 )
 
 func buildConfigFromFlags(masterURL, kubeconfigPath string) (*rest.Config, error) {
@@ -46,6 +47,18 @@ func CreateApiserverClient(apiserverHost, kubeConfig string) (*kubernetes.Client
 	return client, nil
 }
 
+// CreatePolicyClient creates a typed clientset for the policy API
+func CreatePolicyClient(apiserverHost, kubeConfig string) (*versioned.Clientset, error) {
+	cfg, err := buildConfigFromFlags(apiserverHost, kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ContentType = runtime.ContentTypeJSON
+
+	return versioned.NewForConfig(cfg)
+}
+
 // CreateRestClient creates a rest client
 func CreateRestClient(apiserverHost, kubeConfig string) (*rest.RESTClient, *runtime.Scheme, error) {
 	scheme := runtime.NewScheme()
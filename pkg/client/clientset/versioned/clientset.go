@@ -0,0 +1,112 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package versioned
+
+import (
+	glog "github.com/golang/glog"
+	icpv1 "github.com/hchenxa/timebase/pkg/client/clientset/versioned/typed/icp/v1"
+	icpv1beta2 "github.com/hchenxa/timebase/pkg/client/clientset/versioned/typed/icp/v1beta2"
+	discovery "k8s.io/client-go/discovery"
+	rest "k8s.io/client-go/rest"
+	flowcontrol "k8s.io/client-go/util/flowcontrol"
+)
+
+type Interface interface {
+	Discovery() discovery.DiscoveryInterface
+	IcpV1() icpv1.IcpV1Interface
+	IcpV1beta2() icpv1beta2.IcpV1beta2Interface
+	// Deprecated: please explicitly pick a version if possible.
+	Icp() icpv1beta2.IcpV1beta2Interface
+}
+
+// Clientset contains the clients for groups. Each group has exactly one
+// version included in a Clientset.
+type Clientset struct {
+	*discovery.DiscoveryClient
+	icpV1      *icpv1.IcpV1Client
+	icpV1beta2 *icpv1beta2.IcpV1beta2Client
+}
+
+// IcpV1 retrieves the IcpV1Client
+func (c *Clientset) IcpV1() icpv1.IcpV1Interface {
+	return c.icpV1
+}
+
+// IcpV1beta2 retrieves the IcpV1beta2Client
+func (c *Clientset) IcpV1beta2() icpv1beta2.IcpV1beta2Interface {
+	return c.icpV1beta2
+}
+
+// Deprecated: Icp retrieves the default version of IcpClient.
+// Please explicitly pick a version.
+func (c *Clientset) Icp() icpv1beta2.IcpV1beta2Interface {
+	return c.icpV1beta2
+}
+
+// Discovery retrieves the DiscoveryClient
+func (c *Clientset) Discovery() discovery.DiscoveryInterface {
+	if c == nil {
+		return nil
+	}
+	return c.DiscoveryClient
+}
+
+// NewForConfig creates a new Clientset for the given config.
+func NewForConfig(c *rest.Config) (*Clientset, error) {
+	configShallowCopy := *c
+	if configShallowCopy.RateLimiter == nil && configShallowCopy.QPS > 0 {
+		configShallowCopy.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(configShallowCopy.QPS, configShallowCopy.Burst)
+	}
+	var cs Clientset
+	var err error
+	cs.icpV1, err = icpv1.NewForConfig(&configShallowCopy)
+	if err != nil {
+		return nil, err
+	}
+	cs.icpV1beta2, err = icpv1beta2.NewForConfig(&configShallowCopy)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.DiscoveryClient, err = discovery.NewDiscoveryClientForConfig(&configShallowCopy)
+	if err != nil {
+		glog.Errorf("failed to create the DiscoveryClient: %v", err)
+		return nil, err
+	}
+	return &cs, nil
+}
+
+// NewForConfigOrDie creates a new Clientset for the given config and
+// panics if there is an error in the config.
+func NewForConfigOrDie(c *rest.Config) *Clientset {
+	var cs Clientset
+	cs.icpV1 = icpv1.NewForConfigOrDie(c)
+	cs.icpV1beta2 = icpv1beta2.NewForConfigOrDie(c)
+
+	cs.DiscoveryClient = discovery.NewDiscoveryClientForConfigOrDie(c)
+	return &cs
+}
+
+// New creates a new Clientset for the given RESTClient.
+func New(c rest.Interface) *Clientset {
+	var cs Clientset
+	cs.icpV1 = icpv1.New(c)
+	cs.icpV1beta2 = icpv1beta2.New(c)
+
+	cs.DiscoveryClient = discovery.NewDiscoveryClient(c)
+	return &cs
+}
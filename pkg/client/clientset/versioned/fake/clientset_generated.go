@@ -0,0 +1,79 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	clientset "github.com/hchenxa/timebase/pkg/client/clientset/versioned"
+	icpv1 "github.com/hchenxa/timebase/pkg/client/clientset/versioned/typed/icp/v1"
+	fakeicpv1 "github.com/hchenxa/timebase/pkg/client/clientset/versioned/typed/icp/v1/fake"
+	icpv1beta2 "github.com/hchenxa/timebase/pkg/client/clientset/versioned/typed/icp/v1beta2"
+	fakeicpv1beta2 "github.com/hchenxa/timebase/pkg/client/clientset/versioned/typed/icp/v1beta2/fake"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/testing"
+)
+
+// NewSimpleClientset returns a clientset that will respond with the provided objects.
+// It's backed by a very simple object tracker that processes creates, updates and deletions as-is,
+// without applying any validations and/or defaults. It shouldn't be considered a replacement
+// for a real clientset and is mostly useful in simple unit tests.
+func NewSimpleClientset(objects ...runtime.Object) *Clientset {
+	o := testing.NewObjectTracker(scheme, codecs.UniversalDecoder())
+	for _, obj := range objects {
+		if err := o.Add(obj); err != nil {
+			panic(err)
+		}
+	}
+
+	cs := &Clientset{}
+	cs.discovery = &fakediscovery.FakeDiscovery{Fake: &cs.Fake}
+	cs.AddReactor("*", "*", testing.ObjectReaction(o))
+	cs.AddWatchReactor("*", testing.DefaultWatchReactor(watch.NewFake(), nil))
+
+	return cs
+}
+
+// Clientset implements clientset.Interface. Meant to be embedded into a
+// struct to get a default implementation. This makes faking out just the method
+// you want to test easier.
+type Clientset struct {
+	testing.Fake
+	discovery *fakediscovery.FakeDiscovery
+}
+
+func (c *Clientset) Discovery() discovery.DiscoveryInterface {
+	return c.discovery
+}
+
+var _ clientset.Interface = &Clientset{}
+
+// IcpV1 retrieves the IcpV1Client
+func (c *Clientset) IcpV1() icpv1.IcpV1Interface {
+	return &fakeicpv1.FakeIcpV1{Fake: &c.Fake}
+}
+
+// IcpV1beta2 retrieves the IcpV1beta2Client
+func (c *Clientset) IcpV1beta2() icpv1beta2.IcpV1beta2Interface {
+	return &fakeicpv1beta2.FakeIcpV1beta2{Fake: &c.Fake}
+}
+
+// Icp retrieves the IcpV1beta2Client
+func (c *Clientset) Icp() icpv1beta2.IcpV1beta2Interface {
+	return &fakeicpv1beta2.FakeIcpV1beta2{Fake: &c.Fake}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	v1beta2 "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	scheme "github.com/hchenxa/timebase/pkg/client/clientset/versioned/scheme"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// ClusterPoliciesGetter has a method to return a ClusterPolicyInterface.
+// A group's client should implement this interface.
+type ClusterPoliciesGetter interface {
+	ClusterPolicies() ClusterPolicyInterface
+}
+
+// ClusterPolicyInterface has methods to work with ClusterPolicy resources.
+type ClusterPolicyInterface interface {
+	Create(*v1beta2.ClusterPolicy) (*v1beta2.ClusterPolicy, error)
+	Update(*v1beta2.ClusterPolicy) (*v1beta2.ClusterPolicy, error)
+	UpdateStatus(*v1beta2.ClusterPolicy) (*v1beta2.ClusterPolicy, error)
+	Delete(name string, options *meta_v1.DeleteOptions) error
+	DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error
+	Get(name string, options meta_v1.GetOptions) (*v1beta2.ClusterPolicy, error)
+	List(opts meta_v1.ListOptions) (*v1beta2.ClusterPolicyList, error)
+	Watch(opts meta_v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1beta2.ClusterPolicy, err error)
+	ClusterPolicyExpansion
+}
+
+// clusterPolicies implements ClusterPolicyInterface
+type clusterPolicies struct {
+	client rest.Interface
+}
+
+// newClusterPolicies returns a ClusterPolicies
+func newClusterPolicies(c *IcpV1beta2Client) *clusterPolicies {
+	return &clusterPolicies{
+		client: c.RESTClient(),
+	}
+}
+
+// Get takes name of the clusterPolicy, and returns the corresponding clusterPolicy object, and an error if there is any.
+func (c *clusterPolicies) Get(name string, options meta_v1.GetOptions) (result *v1beta2.ClusterPolicy, err error) {
+	result = &v1beta2.ClusterPolicy{}
+	err = c.client.Get().
+		Resource("clusterpolicies").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of ClusterPolicies that match those selectors.
+func (c *clusterPolicies) List(opts meta_v1.ListOptions) (result *v1beta2.ClusterPolicyList, err error) {
+	result = &v1beta2.ClusterPolicyList{}
+	err = c.client.Get().
+		Resource("clusterpolicies").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested clusterPolicies.
+func (c *clusterPolicies) Watch(opts meta_v1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Resource("clusterpolicies").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch()
+}
+
+// Create takes the representation of a clusterPolicy and creates it.  Returns the server's representation of the clusterPolicy, and an error, if there is any.
+func (c *clusterPolicies) Create(clusterPolicy *v1beta2.ClusterPolicy) (result *v1beta2.ClusterPolicy, err error) {
+	result = &v1beta2.ClusterPolicy{}
+	err = c.client.Post().
+		Resource("clusterpolicies").
+		Body(clusterPolicy).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a clusterPolicy and updates it. Returns the server's representation of the clusterPolicy, and an error, if there is any.
+func (c *clusterPolicies) Update(clusterPolicy *v1beta2.ClusterPolicy) (result *v1beta2.ClusterPolicy, err error) {
+	result = &v1beta2.ClusterPolicy{}
+	err = c.client.Put().
+		Resource("clusterpolicies").
+		Name(clusterPolicy.Name).
+		Body(clusterPolicy).
+		Do().
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *clusterPolicies) UpdateStatus(clusterPolicy *v1beta2.ClusterPolicy) (result *v1beta2.ClusterPolicy, err error) {
+	result = &v1beta2.ClusterPolicy{}
+	err = c.client.Put().
+		Resource("clusterpolicies").
+		Name(clusterPolicy.Name).
+		SubResource("status").
+		Body(clusterPolicy).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the clusterPolicy and deletes it. Returns an error if one occurs.
+func (c *clusterPolicies) Delete(name string, options *meta_v1.DeleteOptions) error {
+	return c.client.Delete().
+		Resource("clusterpolicies").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *clusterPolicies) DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error {
+	return c.client.Delete().
+		Resource("clusterpolicies").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched clusterPolicy.
+func (c *clusterPolicies) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1beta2.ClusterPolicy, err error) {
+	result = &v1beta2.ClusterPolicy{}
+	err = c.client.Patch(pt).
+		Resource("clusterpolicies").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
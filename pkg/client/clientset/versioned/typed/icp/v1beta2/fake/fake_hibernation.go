@@ -0,0 +1,138 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	icp_ibm_com_v1beta2 "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeHibernations implements HibernationInterface
+type FakeHibernations struct {
+	Fake *FakeIcpV1beta2
+	ns   string
+}
+
+var hibernationsResource = schema.GroupVersionResource{Group: "icp.ibm.com", Version: "v1beta2", Resource: "hibernations"}
+
+var hibernationsKind = schema.GroupVersionKind{Group: "icp.ibm.com", Version: "v1beta2", Kind: "Hibernation"}
+
+// Get takes name of the hibernation, and returns the corresponding hibernation object, and an error if there is any.
+func (c *FakeHibernations) Get(name string, options v1.GetOptions) (result *icp_ibm_com_v1beta2.Hibernation, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(hibernationsResource, c.ns, name), &icp_ibm_com_v1beta2.Hibernation{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*icp_ibm_com_v1beta2.Hibernation), err
+}
+
+// List takes label and field selectors, and returns the list of Hibernations that match those selectors.
+func (c *FakeHibernations) List(opts v1.ListOptions) (result *icp_ibm_com_v1beta2.HibernationList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(hibernationsResource, hibernationsKind, c.ns, opts), &icp_ibm_com_v1beta2.HibernationList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &icp_ibm_com_v1beta2.HibernationList{}
+	for _, item := range obj.(*icp_ibm_com_v1beta2.HibernationList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested hibernations.
+func (c *FakeHibernations) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(hibernationsResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a hibernation and creates it.  Returns the server's representation of the hibernation, and an error, if there is any.
+func (c *FakeHibernations) Create(hibernation *icp_ibm_com_v1beta2.Hibernation) (result *icp_ibm_com_v1beta2.Hibernation, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(hibernationsResource, c.ns, hibernation), &icp_ibm_com_v1beta2.Hibernation{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*icp_ibm_com_v1beta2.Hibernation), err
+}
+
+// Update takes the representation of a hibernation and updates it. Returns the server's representation of the hibernation, and an error, if there is any.
+func (c *FakeHibernations) Update(hibernation *icp_ibm_com_v1beta2.Hibernation) (result *icp_ibm_com_v1beta2.Hibernation, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(hibernationsResource, c.ns, hibernation), &icp_ibm_com_v1beta2.Hibernation{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*icp_ibm_com_v1beta2.Hibernation), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeHibernations) UpdateStatus(hibernation *icp_ibm_com_v1beta2.Hibernation) (*icp_ibm_com_v1beta2.Hibernation, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(hibernationsResource, "status", c.ns, hibernation), &icp_ibm_com_v1beta2.Hibernation{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*icp_ibm_com_v1beta2.Hibernation), err
+}
+
+// Delete takes name of the hibernation and deletes it. Returns an error if one occurs.
+func (c *FakeHibernations) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(hibernationsResource, c.ns, name), &icp_ibm_com_v1beta2.Hibernation{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeHibernations) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(hibernationsResource, c.ns, listOptions)
+
+	_, err := c.Fake.Invokes(action, &icp_ibm_com_v1beta2.HibernationList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched hibernation.
+func (c *FakeHibernations) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *icp_ibm_com_v1beta2.Hibernation, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(hibernationsResource, c.ns, name, data, subresources...), &icp_ibm_com_v1beta2.Hibernation{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*icp_ibm_com_v1beta2.Hibernation), err
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	v1beta2 "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	scheme "github.com/hchenxa/timebase/pkg/client/clientset/versioned/scheme"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// HibernationsGetter has a method to return a HibernationInterface.
+// A group's client should implement this interface.
+type HibernationsGetter interface {
+	Hibernations(namespace string) HibernationInterface
+}
+
+// HibernationInterface has methods to work with Hibernation resources.
+type HibernationInterface interface {
+	Create(*v1beta2.Hibernation) (*v1beta2.Hibernation, error)
+	Update(*v1beta2.Hibernation) (*v1beta2.Hibernation, error)
+	UpdateStatus(*v1beta2.Hibernation) (*v1beta2.Hibernation, error)
+	Delete(name string, options *meta_v1.DeleteOptions) error
+	DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error
+	Get(name string, options meta_v1.GetOptions) (*v1beta2.Hibernation, error)
+	List(opts meta_v1.ListOptions) (*v1beta2.HibernationList, error)
+	Watch(opts meta_v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1beta2.Hibernation, err error)
+	HibernationExpansion
+}
+
+// hibernations implements HibernationInterface
+type hibernations struct {
+	client rest.Interface
+	ns     string
+}
+
+// newHibernations returns a Hibernations
+func newHibernations(c *IcpV1beta2Client, namespace string) *hibernations {
+	return &hibernations{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the hibernation, and returns the corresponding hibernation object, and an error if there is any.
+func (c *hibernations) Get(name string, options meta_v1.GetOptions) (result *v1beta2.Hibernation, err error) {
+	result = &v1beta2.Hibernation{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("hibernations").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of Hibernations that match those selectors.
+func (c *hibernations) List(opts meta_v1.ListOptions) (result *v1beta2.HibernationList, err error) {
+	result = &v1beta2.HibernationList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("hibernations").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested hibernations.
+func (c *hibernations) Watch(opts meta_v1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("hibernations").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch()
+}
+
+// Create takes the representation of a hibernation and creates it.  Returns the server's representation of the hibernation, and an error, if there is any.
+func (c *hibernations) Create(hibernation *v1beta2.Hibernation) (result *v1beta2.Hibernation, err error) {
+	result = &v1beta2.Hibernation{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("hibernations").
+		Body(hibernation).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a hibernation and updates it. Returns the server's representation of the hibernation, and an error, if there is any.
+func (c *hibernations) Update(hibernation *v1beta2.Hibernation) (result *v1beta2.Hibernation, err error) {
+	result = &v1beta2.Hibernation{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("hibernations").
+		Name(hibernation.Name).
+		Body(hibernation).
+		Do().
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *hibernations) UpdateStatus(hibernation *v1beta2.Hibernation) (result *v1beta2.Hibernation, err error) {
+	result = &v1beta2.Hibernation{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("hibernations").
+		Name(hibernation.Name).
+		SubResource("status").
+		Body(hibernation).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the hibernation and deletes it. Returns an error if one occurs.
+func (c *hibernations) Delete(name string, options *meta_v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("hibernations").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *hibernations) DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("hibernations").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched hibernation.
+func (c *hibernations) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1beta2.Hibernation, err error) {
+	result = &v1beta2.Hibernation{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("hibernations").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const crdPath = "/apis/apiextensions.k8s.io/v1/customresourcedefinitions"
+
+// Webhook configures the conversion webhook of a CustomResourceDefinition
+// that serves several versions.
+type Webhook struct {
+	// CABundle, if not empty, is the CA the apiserver uses to verify the
+	// webhook.
+	CABundle []byte
+}
+
+// EnsureCustomResourceDefinition installs the CustomResourceDefinition in
+// manifest, or upgrades it in place when it already exists, and waits until
+// the apiserver reports it as established. Without a webhook, a
+// CustomResourceDefinition that converts through one is installed without
+// conversion and only serves its storage version; it is refused if objects
+// are stored in another version, since they could not be read.
+func EnsureCustomResourceDefinition(client kubernetes.Interface, manifest []byte, webhook *Webhook) error {
+	data, err := yaml.YAMLToJSON(manifest)
+	if err != nil {
+		return err
+	}
+	crd := &unstructured.Unstructured{}
+	if err := crd.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	name := crd.GetName()
+	storage := ""
+	switch {
+	case webhook == nil:
+		storage = withoutConversion(crd)
+	case len(webhook.CABundle) > 0:
+		if err := setCABundle(crd, webhook.CABundle); err != nil {
+			return err
+		}
+	}
+	if storage != "" {
+		log.Printf("No conversion webhook is configured, CustomResourceDefinition %s only serves %s", name, storage)
+	}
+	if data, err = crd.MarshalJSON(); err != nil {
+		return err
+	}
+	rc := client.Discovery().RESTClient()
+
+	raw, err := rc.Get().AbsPath(crdPath, name).DoRaw()
+	switch {
+	case errors.IsNotFound(err):
+		log.Printf("Creating CustomResourceDefinition %s", name)
+		if _, err := rc.Post().AbsPath(crdPath).Body(data).DoRaw(); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		existing := &unstructured.Unstructured{}
+		if err := existing.UnmarshalJSON(raw); err != nil {
+			return err
+		}
+		if storage != "" {
+			if err := checkStoredVersions(existing, storage); err != nil {
+				return err
+			}
+		}
+		crd.SetResourceVersion(existing.GetResourceVersion())
+		body, err := crd.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		log.Printf("Upgrading CustomResourceDefinition %s", name)
+		if _, err := rc.Put().AbsPath(crdPath, name).Body(body).DoRaw(); err != nil {
+			return err
+		}
+	}
+
+	return wait.PollImmediate(time.Second, time.Minute, func() (bool, error) {
+		raw, err := rc.Get().AbsPath(crdPath, name).DoRaw()
+		if err != nil {
+			return false, err
+		}
+		current := &unstructured.Unstructured{}
+		if err := current.UnmarshalJSON(raw); err != nil {
+			return false, err
+		}
+		return isEstablished(current)
+	})
+}
+
+func setCABundle(crd *unstructured.Unstructured, caBundle []byte) error {
+	spec, _ := crd.Object["spec"].(map[string]interface{})
+	conversion, _ := spec["conversion"].(map[string]interface{})
+	webhook, _ := conversion["webhook"].(map[string]interface{})
+	clientConfig, ok := webhook["clientConfig"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("CustomResourceDefinition %s has no conversion webhook", crd.GetName())
+	}
+	clientConfig["caBundle"] = base64.StdEncoding.EncodeToString(caBundle)
+	return nil
+}
+
+// withoutConversion replaces the conversion webhook of crd, if it has one, by
+// no conversion and stops serving every version but the storage version,
+// which it returns. Without conversion the apiserver would hand out stored
+// objects as another version unchanged.
+func withoutConversion(crd *unstructured.Unstructured) string {
+	spec, _ := crd.Object["spec"].(map[string]interface{})
+	conversion, _ := spec["conversion"].(map[string]interface{})
+	if conversion["strategy"] != "Webhook" {
+		return ""
+	}
+	spec["conversion"] = map[string]interface{}{"strategy": "None"}
+	storage := ""
+	versions, _ := spec["versions"].([]interface{})
+	for _, v := range versions {
+		version, _ := v.(map[string]interface{})
+		if version["storage"] == true {
+			storage, _ = version["name"].(string)
+			continue
+		}
+		version["served"] = false
+	}
+	return storage
+}
+
+// checkStoredVersions refuses to drop the conversion of crd while objects
+// may be stored in another version than storage.
+func checkStoredVersions(crd *unstructured.Unstructured, storage string) error {
+	status, _ := crd.Object["status"].(map[string]interface{})
+	stored, _ := status["storedVersions"].([]interface{})
+	for _, v := range stored {
+		if v != storage {
+			return fmt.Errorf("CustomResourceDefinition %s may store objects in %v, which cannot be read "+
+				"as %s without the conversion webhook", crd.GetName(), v, storage)
+		}
+	}
+	return nil
+}
+
+func isEstablished(crd *unstructured.Unstructured) (bool, error) {
+	status, _ := crd.Object["status"].(map[string]interface{})
+	conditions, _ := status["conditions"].([]interface{})
+	for _, c := range conditions {
+		cond, _ := c.(map[string]interface{})
+		switch cond["type"] {
+		case "Established":
+			if cond["status"] == "True" {
+				return true, nil
+			}
+		case "NamesAccepted":
+			if cond["status"] == "False" {
+				return false, fmt.Errorf("names of CustomResourceDefinition %s were not accepted: %v", crd.GetName(), cond["message"])
+			}
+		}
+	}
+	return false, nil
+}
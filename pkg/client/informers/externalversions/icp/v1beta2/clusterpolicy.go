@@ -0,0 +1,73 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file was automatically generated by informer-gen
+
+package v1beta2
+
+import (
+	icp_ibm_com_v1beta2 "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	versioned "github.com/hchenxa/timebase/pkg/client/clientset/versioned"
+	internalinterfaces "github.com/hchenxa/timebase/pkg/client/informers/externalversions/internalinterfaces"
+	v1beta2 "github.com/hchenxa/timebase/pkg/client/listers/icp/v1beta2"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	watch "k8s.io/apimachinery/pkg/watch"
+	cache "k8s.io/client-go/tools/cache"
+	time "time"
+)
+
+// ClusterPolicyInformer provides access to a shared informer and lister for
+// ClusterPolicies.
+type ClusterPolicyInformer interface {
+	Informer() cache.SharedIndexInformer
+	Lister() v1beta2.ClusterPolicyLister
+}
+
+type clusterPolicyInformer struct {
+	factory internalinterfaces.SharedInformerFactory
+}
+
+// NewClusterPolicyInformer constructs a new informer for ClusterPolicy type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewClusterPolicyInformer(client versioned.Interface, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+				return client.IcpV1beta2().ClusterPolicies().List(options)
+			},
+			WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+				return client.IcpV1beta2().ClusterPolicies().Watch(options)
+			},
+		},
+		&icp_ibm_com_v1beta2.ClusterPolicy{},
+		resyncPeriod,
+		indexers,
+	)
+}
+
+func defaultClusterPolicyInformer(client versioned.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return NewClusterPolicyInformer(client, resyncPeriod, cache.Indexers{})
+}
+
+func (f *clusterPolicyInformer) Informer() cache.SharedIndexInformer {
+	return f.factory.InformerFor(&icp_ibm_com_v1beta2.ClusterPolicy{}, defaultClusterPolicyInformer)
+}
+
+func (f *clusterPolicyInformer) Lister() v1beta2.ClusterPolicyLister {
+	return v1beta2.NewClusterPolicyLister(f.Informer().GetIndexer())
+}
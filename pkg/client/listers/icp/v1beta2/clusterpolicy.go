@@ -0,0 +1,65 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file was automatically generated by lister-gen
+
+package v1beta2
+
+import (
+	v1beta2 "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ClusterPolicyLister helps list ClusterPolicies.
+type ClusterPolicyLister interface {
+	// List lists all ClusterPolicies in the indexer.
+	List(selector labels.Selector) (ret []*v1beta2.ClusterPolicy, err error)
+	// Get retrieves the ClusterPolicy from the index for a given name.
+	Get(name string) (*v1beta2.ClusterPolicy, error)
+	ClusterPolicyListerExpansion
+}
+
+// clusterPolicyLister implements the ClusterPolicyLister interface.
+type clusterPolicyLister struct {
+	indexer cache.Indexer
+}
+
+// NewClusterPolicyLister returns a new ClusterPolicyLister.
+func NewClusterPolicyLister(indexer cache.Indexer) ClusterPolicyLister {
+	return &clusterPolicyLister{indexer: indexer}
+}
+
+// List lists all ClusterPolicies in the indexer.
+func (s *clusterPolicyLister) List(selector labels.Selector) (ret []*v1beta2.ClusterPolicy, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1beta2.ClusterPolicy))
+	})
+	return ret, err
+}
+
+// Get retrieves the ClusterPolicy from the index for a given name.
+func (s *clusterPolicyLister) Get(name string) (*v1beta2.ClusterPolicy, error) {
+	obj, exists, err := s.indexer.GetByKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1beta2.Resource("clusterpolicy"), name)
+	}
+	return obj.(*v1beta2.ClusterPolicy), nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file was automatically generated by lister-gen
+
+package v1beta2
+
+import (
+	v1beta2 "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// HibernationLister helps list Hibernations.
+type HibernationLister interface {
+	// List lists all Hibernations in the indexer.
+	List(selector labels.Selector) (ret []*v1beta2.Hibernation, err error)
+	// Hibernations returns an object that can list and get Hibernations.
+	Hibernations(namespace string) HibernationNamespaceLister
+	HibernationListerExpansion
+}
+
+// hibernationLister implements the HibernationLister interface.
+type hibernationLister struct {
+	indexer cache.Indexer
+}
+
+// NewHibernationLister returns a new HibernationLister.
+func NewHibernationLister(indexer cache.Indexer) HibernationLister {
+	return &hibernationLister{indexer: indexer}
+}
+
+// List lists all Hibernations in the indexer.
+func (s *hibernationLister) List(selector labels.Selector) (ret []*v1beta2.Hibernation, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1beta2.Hibernation))
+	})
+	return ret, err
+}
+
+// Hibernations returns an object that can list and get Hibernations.
+func (s *hibernationLister) Hibernations(namespace string) HibernationNamespaceLister {
+	return hibernationNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// HibernationNamespaceLister helps list and get Hibernations.
+type HibernationNamespaceLister interface {
+	// List lists all Hibernations in the indexer for a given namespace.
+	List(selector labels.Selector) (ret []*v1beta2.Hibernation, err error)
+	// Get retrieves the Hibernation from the indexer for a given namespace and name.
+	Get(name string) (*v1beta2.Hibernation, error)
+	HibernationNamespaceListerExpansion
+}
+
+// hibernationNamespaceLister implements the HibernationNamespaceLister
+// interface.
+type hibernationNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all Hibernations in the indexer for a given namespace.
+func (s hibernationNamespaceLister) List(selector labels.Selector) (ret []*v1beta2.Hibernation, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1beta2.Hibernation))
+	})
+	return ret, err
+}
+
+// Get retrieves the Hibernation from the indexer for a given namespace and name.
+func (s hibernationNamespaceLister) Get(name string) (*v1beta2.Hibernation, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1beta2.Resource("hibernation"), name)
+	}
+	return obj.(*v1beta2.Hibernation), nil
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"github.com/hchenxa/timebase/pkg/hpa"
+)
+
+// applyRule scales the target of the policy of e as requested by its due
+// rule, within the bounds of the policy. When the target has the autoscaler
+// h, the rule sets its bounds instead. A restart rule rolls the target out
+// again instead of scaling it.
+func (a *TimebasedController) applyRule(e *evaluation, h *hpa.HorizontalPodAutoscaler, reference string) error {
+	p, rule := e.policy, e.due
+	if rule.Action == api.Restart {
+		return a.restart(e, reference)
+	}
+	scale, err := a.scales.Get(p.ObjectMeta.Namespace, *e.target)
+	if err != nil {
+		return fmt.Errorf("failed to query scale subresource: %v", err)
+	}
+
+	currentReplicas := scale.Status.Replicas
+
+	replicas := rule.Replicas
+	switch rule.Action {
+	case api.ScaleBy:
+		replicas = scale.Spec.Replicas + rule.Delta
+	case api.ScaleByPercent:
+		replicas = percentOf(e.baseline(scale.Spec.Replicas), rule.Percent)
+	case api.Restore:
+		if h != nil {
+			return a.restoreAutoscaler(e, h, reference)
+		}
+		if e.status.OriginalReplicas == nil {
+			glog.V(4).Infof("policy %s/%s has not changed %s, nothing to restore", p.Namespace, p.Name, reference)
+			return nil
+		}
+		replicas = *e.status.OriginalReplicas
+	}
+	// A restore returns the target to where it was, even if the bounds of
+	// the policy have changed since.
+	if rule.Action != api.Restore {
+		replicas = clampReplicas(p, replicas)
+	}
+	e.requestRuleCapacity(replicas)
+
+	switch {
+	case rule.Action == api.ScaleUp && replicas <= currentReplicas:
+		glog.V(4).Infof("The request replicas was less than current replicas, no need to scale up")
+		return nil
+	case rule.Action == api.ScaleDown && replicas >= currentReplicas:
+		glog.V(4).Infof("the request replicas was large than replicas, no need to scale down")
+		return nil
+	case h != nil:
+		return a.applyRuleToAutoscaler(e, h, replicas, reference)
+	case replicas == scale.Spec.Replicas:
+		glog.V(4).Infof("%s already runs %d replicas", reference, replicas)
+		if rule.Action == api.Restore {
+			e.status.OriginalReplicas = nil
+		}
+		return nil
+	}
+
+	glog.V(2).Infof("rule %s of policy %s/%s scales %s from %d to %d", rule.Name, p.Namespace, p.Name, reference, currentReplicas, replicas)
+	original := scale.Spec.Replicas
+	scale.Spec.Replicas = replicas
+	if _, err = a.scales.Update(p.ObjectMeta.Namespace, *e.target, scale); err != nil {
+		return err
+	}
+	e.status.AppliedReplicas = &replicas
+	switch {
+	case rule.Action == api.Restore:
+		// Only a restore that went through clears the scale to restore, so
+		// that a failed one is tried again by the next rule.
+		e.status.OriginalReplicas = nil
+	case e.status.OriginalReplicas == nil:
+		e.status.OriginalReplicas = &original
+	}
+	return nil
+}
+
+// baseline returns the scale percentages are measured against. current is
+// captured as the new baseline when there is none yet, or when the target is
+// no longer at the scale the policy last set it to.
+func (e *evaluation) baseline(current int32) int32 {
+	s := &e.status
+	if s.BaselineReplicas == nil || s.AppliedReplicas == nil || *s.AppliedReplicas != current {
+		s.BaselineReplicas = &current
+	}
+	return *s.BaselineReplicas
+}
+
+// percentOf returns baseline changed by percent percent, rounded to the
+// nearest replica.
+func percentOf(baseline, percent int32) int32 {
+	replicas := (int64(baseline)*(100+int64(percent)) + 50) / 100
+	if replicas < 0 {
+		return 0
+	}
+	return int32(replicas)
+}
+
+// clampReplicas bounds replicas to the limits of p and to zero. The lower
+// bound wins when the limits contradict each other.
+func clampReplicas(p *api.Policy, replicas int32) int32 {
+	if max := p.Spec.MaxReplicas; max != nil && replicas > *max {
+		replicas = *max
+	}
+	if min := p.Spec.MinReplicas; min != nil && replicas < *min {
+		replicas = *min
+	}
+	if replicas < 0 {
+		replicas = 0
+	}
+	return replicas
+}
+
+func copyReplicas(replicas *int32) *int32 {
+	if replicas == nil {
+		return nil
+	}
+	r := *replicas
+	return &r
+}
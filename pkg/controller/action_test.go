@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"testing"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+func int32p(n int32) *int32 {
+	return &n
+}
+
+func TestClampReplicas(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max *int32
+		replicas int32
+		want     int32
+	}{
+		{"no limits", nil, nil, 7, 7},
+		{"negative goes to zero", nil, nil, -3, 0},
+		{"below min", int32p(2), nil, 1, 2},
+		{"above max", nil, int32p(5), 9, 5},
+		{"within limits", int32p(2), int32p(5), 4, 4},
+		{"min wins over a smaller max", int32p(6), int32p(3), 4, 6},
+		{"zero max", nil, int32p(0), 4, 0},
+	}
+	for _, tt := range tests {
+		p := &api.Policy{Spec: api.PolicySpec{MinReplicas: tt.min, MaxReplicas: tt.max}}
+		if got := clampReplicas(p, tt.replicas); got != tt.want {
+			t.Errorf("%s: clampReplicas(%d) = %d, want %d", tt.name, tt.replicas, got, tt.want)
+		}
+	}
+}
+
+func TestPercentOf(t *testing.T) {
+	tests := []struct {
+		name              string
+		baseline, percent int32
+		want              int32
+	}{
+		{"unchanged", 10, 0, 10},
+		{"half again", 10, 50, 15},
+		{"half", 10, -50, 5},
+		{"double", 3, 100, 6},
+		{"rounds half up", 5, 10, 6},
+		{"rounds down", 4, 10, 4},
+		{"all gone", 10, -100, 0},
+		{"zero baseline", 0, 300, 0},
+	}
+	for _, tt := range tests {
+		if got := percentOf(tt.baseline, tt.percent); got != tt.want {
+			t.Errorf("%s: percentOf(%d, %d) = %d, want %d", tt.name, tt.baseline, tt.percent, got, tt.want)
+		}
+	}
+}
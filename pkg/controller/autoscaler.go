@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"github.com/hchenxa/timebase/pkg/hpa"
+)
+
+// autoscalerBounds returns the bounds an autoscaler that had the original
+// bounds gets for replicas: replicas becomes its minimum, which its maximum
+// is raised to if needed, unless override says otherwise. An autoscaler
+// cannot scale to zero, so its minimum is at least one.
+func autoscalerBounds(original api.HorizontalPodAutoscalerBounds, replicas int32, override *api.HorizontalPodAutoscalerBounds) api.HorizontalPodAutoscalerBounds {
+	b := api.HorizontalPodAutoscalerBounds{
+		MinReplicas:                    &replicas,
+		MaxReplicas:                    copyReplicas(original.MaxReplicas),
+		TargetCPUUtilizationPercentage: copyReplicas(original.TargetCPUUtilizationPercentage),
+	}
+	if override != nil {
+		if override.MinReplicas != nil {
+			b.MinReplicas = copyReplicas(override.MinReplicas)
+		}
+		if override.MaxReplicas != nil {
+			b.MaxReplicas = copyReplicas(override.MaxReplicas)
+		}
+		if override.TargetCPUUtilizationPercentage != nil {
+			b.TargetCPUUtilizationPercentage = copyReplicas(override.TargetCPUUtilizationPercentage)
+		}
+	}
+	if *b.MinReplicas < 1 {
+		one := int32(1)
+		b.MinReplicas = &one
+	}
+	if b.MaxReplicas == nil || *b.MaxReplicas < *b.MinReplicas {
+		b.MaxReplicas = copyReplicas(b.MinReplicas)
+	}
+	return b
+}
+
+// setBounds sets the bounds of the autoscaler h of the target of e, unless it
+// has them already.
+func (a *TimebasedController) setBounds(e *evaluation, h *hpa.HorizontalPodAutoscaler, bounds api.HorizontalPodAutoscalerBounds, reference string) error {
+	if equality.Semantic.DeepEqual(h.Bounds, bounds) {
+		return nil
+	}
+	glog.V(2).Infof("autoscaler %s of %s gets bounds %s", h.Name, reference, formatBounds(bounds))
+	if err := a.hpas.SetBounds(e.policy.Namespace, h.Name, bounds); err != nil {
+		return err
+	}
+	h.Bounds = bounds
+	return nil
+}
+
+// formatBounds renders b for the log, unset bounds as "-".
+func formatBounds(b api.HorizontalPodAutoscalerBounds) string {
+	format := func(v *int32) string {
+		if v == nil {
+			return "-"
+		}
+		return fmt.Sprint(*v)
+	}
+	return fmt.Sprintf("min %s, max %s, cpu %s%%", format(b.MinReplicas), format(b.MaxReplicas), format(b.TargetCPUUtilizationPercentage))
+}
+
+// applyRuleToAutoscaler makes replicas the minimum of the autoscaler h, on
+// behalf of the due rule of e, and records the bounds h had before the policy
+// first changed them.
+func (a *TimebasedController) applyRuleToAutoscaler(e *evaluation, h *hpa.HorizontalPodAutoscaler, replicas int32, reference string) error {
+	original := e.status.OriginalHorizontalPodAutoscaler
+	if original == nil {
+		original = h.Bounds.DeepCopy()
+	}
+	glog.V(2).Infof("rule %s of policy %s/%s scales %s to %d through its autoscaler", e.due.Name, e.policy.Namespace, e.policy.Name, reference, replicas)
+	if err := a.setBounds(e, h, autoscalerBounds(*original, replicas, nil), reference); err != nil {
+		return err
+	}
+	e.status.AppliedReplicas = &replicas
+	e.status.OriginalHorizontalPodAutoscaler = original
+	return nil
+}
+
+// restoreAutoscaler puts back the bounds the autoscaler h had before the
+// policy of e first changed them.
+func (a *TimebasedController) restoreAutoscaler(e *evaluation, h *hpa.HorizontalPodAutoscaler, reference string) error {
+	original := e.status.OriginalHorizontalPodAutoscaler
+	if original == nil {
+		glog.V(4).Infof("policy %s/%s has not changed the autoscaler of %s, nothing to restore", e.policy.Namespace, e.policy.Name, reference)
+		return nil
+	}
+	if err := a.setBounds(e, h, *original, reference); err != nil {
+		return err
+	}
+	e.status.OriginalHorizontalPodAutoscaler = nil
+	return nil
+}
+
+// boundAutoscaler applies the windows of evals to the autoscaler h of their
+// target. While a window is open the autoscaler gets the bounds of the
+// chosen window; once every window has closed the bounds it had before they
+// opened are put back, the scales windows return to are left to the
+// autoscaler.
+func (a *TimebasedController) boundAutoscaler(evals []*evaluation, chosen *evaluation, h *hpa.HorizontalPodAutoscaler, reference string) {
+	var original *api.HorizontalPodAutoscalerBounds
+	for _, e := range evals {
+		if hasScaleWindows(e.policy) && e.status.OriginalHorizontalPodAutoscaler != nil {
+			original = e.status.OriginalHorizontalPodAutoscaler
+			break
+		}
+	}
+
+	var bounds api.HorizontalPodAutoscalerBounds
+	open := chosen != nil && chosen.active
+	switch {
+	case open:
+		if original == nil {
+			original = h.Bounds.DeepCopy()
+		}
+		bounds = autoscalerBounds(*original, *chosen.replicas, chosen.window.HorizontalPodAutoscaler)
+		for _, e := range evals {
+			if hasScaleWindows(e.policy) {
+				e.status.DesiredReplicas = copyReplicas(bounds.MinReplicas)
+			}
+		}
+	case original != nil:
+		bounds = *original
+	default:
+		return
+	}
+
+	if err := a.setBounds(evals[0], h, bounds, reference); err != nil {
+		glog.Errorf("failed to set the bounds of the autoscaler of %s: %v", reference, err)
+		for _, e := range evals {
+			e.err = err
+		}
+		return
+	}
+	for _, e := range evals {
+		if !hasScaleWindows(e.policy) {
+			continue
+		}
+		switch {
+		case !open:
+			e.status.OriginalHorizontalPodAutoscaler = nil
+		case e.active && e.status.OriginalHorizontalPodAutoscaler == nil:
+			e.status.OriginalHorizontalPodAutoscaler = original.DeepCopy()
+		}
+	}
+}
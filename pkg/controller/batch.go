@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"github.com/hchenxa/timebase/pkg/object"
+)
+
+// applySuspend suspends or resumes the CronJob the target of e points at as
+// the open window w asks, recording in applied whether it was suspended
+// before the window first changed it.
+func (a *TimebasedController) applySuspend(e *evaluation, w *api.ScalingWindow, applied *api.AppliedWindow, reference string) error {
+	if e.target.Kind != "CronJob" {
+		return fmt.Errorf("%s is not a CronJob", reference)
+	}
+	job, err := a.cronJobs.Get(e.policy.Namespace, e.target.Name)
+	if err != nil {
+		return err
+	}
+	if applied.Suspend == nil {
+		suspended := job.Suspend
+		applied.Suspend = &suspended
+	}
+	suspend := w.Suspend == nil || *w.Suspend
+	if job.Suspend == suspend {
+		return nil
+	}
+	glog.V(2).Infof("window %s of policy %s/%s sets suspend of %s to %t", w.Name, e.policy.Namespace, e.policy.Name, reference, suspend)
+	return a.cronJobs.SetSuspend(e.policy.Namespace, e.target.Name, suspend)
+}
+
+// restoreSuspend puts back whether the CronJob the target of e points at was
+// suspended before the window recorded in applied opened.
+func (a *TimebasedController) restoreSuspend(e *evaluation, applied *api.AppliedWindow, reference string) error {
+	job, err := a.cronJobs.Get(e.policy.Namespace, e.target.Name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if job.Suspend == *applied.Suspend {
+		return nil
+	}
+	glog.V(2).Infof("window %s of policy %s/%s sets suspend of %s back to %t", applied.Name, e.policy.Namespace, e.policy.Name, reference, *applied.Suspend)
+	return a.cronJobs.SetSuspend(e.policy.Namespace, e.target.Name, *applied.Suspend)
+}
+
+// applyParallelism gives the Job the target of e points at the parallelism
+// the open window w asks for, recording in applied the one it had before the
+// window first changed it.
+func (a *TimebasedController) applyParallelism(e *evaluation, w *api.ScalingWindow, applied *api.AppliedWindow, reference string) error {
+	if e.target.Kind != "Job" {
+		return fmt.Errorf("%s is not a Job", reference)
+	}
+	if w.Parallelism == nil {
+		return fmt.Errorf("no parallelism is set")
+	}
+	current, err := a.parallelism(e)
+	if err != nil {
+		return err
+	}
+	if applied.Parallelism == nil {
+		applied.Parallelism = copyReplicas(&current)
+	}
+	if current == *w.Parallelism {
+		return nil
+	}
+	glog.V(2).Infof("window %s of policy %s/%s sets the parallelism of %s from %d to %d", w.Name, e.policy.Namespace, e.policy.Name, reference, current, *w.Parallelism)
+	return a.setParallelism(e, *w.Parallelism)
+}
+
+// restoreParallelism puts back the parallelism the Job the target of e
+// points at had before the window recorded in applied opened.
+func (a *TimebasedController) restoreParallelism(e *evaluation, applied *api.AppliedWindow, reference string) error {
+	current, err := a.parallelism(e)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current == *applied.Parallelism {
+		return nil
+	}
+	glog.V(2).Infof("window %s of policy %s/%s sets the parallelism of %s back to %d", applied.Name, e.policy.Namespace, e.policy.Name, reference, *applied.Parallelism)
+	return a.setParallelism(e, *applied.Parallelism)
+}
+
+// parallelism returns the parallelism of the Job the target of e points at.
+// The apiserver defaults it to one.
+func (a *TimebasedController) parallelism(e *evaluation) (int32, error) {
+	obj, err := a.objects.Get(e.policy.Namespace, *e.target)
+	if err != nil {
+		return 0, err
+	}
+	switch n := object.Field(obj.Object, "spec", "parallelism").(type) {
+	case int64:
+		return int32(n), nil
+	case float64:
+		return int32(n), nil
+	}
+	return 1, nil
+}
+
+// setParallelism sets the parallelism of the Job the target of e points at.
+func (a *TimebasedController) setParallelism(e *evaluation, parallelism int32) error {
+	patch := fmt.Sprintf(`{"spec":{"parallelism":%d}}`, parallelism)
+	_, err := a.objects.Patch(e.policy.Namespace, *e.target, types.MergePatchType, []byte(patch))
+	return err
+}
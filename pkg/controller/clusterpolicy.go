@@ -0,0 +1,297 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+// clusterEvaluation is the state of a cluster policy in every namespace it
+// applies to.
+type clusterEvaluation struct {
+	policy *api.ClusterPolicy
+	// namespaces holds the evaluations of the policy in each namespace.
+	namespaces map[string][]*evaluation
+	// kept holds the last known summary of the namespaces the policy could
+	// not be evaluated in.
+	kept []api.NamespaceStatus
+	// overridden lists the namespaces where a Policy replaces it.
+	overridden []string
+	// releases holds the evaluations of the policy in the namespaces it
+	// applied to and no longer does, where what its windows changed is
+	// undone. Every namespace is released once the policy is deleted.
+	releases map[string][]*evaluation
+}
+
+// evaluateClusterPolicy evaluates cp at now in every namespace its selector
+// matches, except the ones where a policy listed in overrides replaces it.
+// In each namespace cp is evaluated as a Policy with the same spec would be.
+// The namespaces it recorded a status in and no longer applies to are
+// released, like a deleted Policy.
+func (a *TimebasedController) evaluateClusterPolicy(cp *api.ClusterPolicy, overrides map[string]sets.String, now time.Time) (*clusterEvaluation, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&cp.Spec.NamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+	var nsl []*corev1.Namespace
+	if cp.DeletionTimestamp == nil {
+		err := cache.ListAll(a.namespaceInformer.GetStore(), selector, func(obj interface{}) {
+			nsl = append(nsl, obj.(*corev1.Namespace))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ce := &clusterEvaluation{policy: cp, namespaces: map[string][]*evaluation{}, releases: map[string][]*evaluation{}}
+	kept := sets.NewString()
+	for _, ns := range nsl {
+		if ns.Status.Phase == corev1.NamespaceTerminating {
+			continue
+		}
+		if overrides[ns.Name].Has(cp.Name) {
+			ce.overridden = append(ce.overridden, ns.Name)
+			continue
+		}
+		p, err := a.namespacePolicy(cp, ns.Name, now)
+		var evals []*evaluation
+		if err == nil {
+			evals, err = a.evaluateTargets(p, now)
+		}
+		if err != nil {
+			glog.Errorf("failed to resolve the targets of cluster policy %s in namespace %s: %v", cp.Name, ns.Name, err)
+			if old := cp.Status.NamespaceStatus(ns.Name); old != nil {
+				ce.kept = append(ce.kept, *old.DeepCopy())
+				kept.Insert(ns.Name)
+			}
+			continue
+		}
+		ce.namespaces[ns.Name] = evals
+	}
+	sort.Strings(ce.overridden)
+
+	for _, ns := range cp.Status.Namespaces {
+		if _, ok := ce.namespaces[ns.Name]; ok || kept.Has(ns.Name) {
+			continue
+		}
+		p, err := a.namespacePolicy(cp, ns.Name, now)
+		var evals []*evaluation
+		if err == nil {
+			evals, err = a.evaluateRelease(p, now)
+		}
+		if err != nil {
+			glog.Errorf("failed to resolve the targets of cluster policy %s in namespace %s it no longer applies to: %v", cp.Name, ns.Name, err)
+			ce.kept = append(ce.kept, *ns.DeepCopy())
+			continue
+		}
+		ce.releases[ns.Name] = evals
+	}
+	return ce, nil
+}
+
+// namespacePolicy returns the Policy cp stands for in namespace. It carries
+// the status cp keeps in its state Policy there, and is created when cp
+// started to apply to the namespace so that schedules from before are not
+// caught up on. It is controlled by cp, which owns what it creates.
+func (a *TimebasedController) namespacePolicy(cp *api.ClusterPolicy, namespace string, now time.Time) (*api.Policy, error) {
+	p := &api.Policy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              cp.Name,
+			Namespace:         namespace,
+			CreationTimestamp: metav1.NewTime(now),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(cp, api.SchemeGroupVersion.WithKind("ClusterPolicy")),
+			},
+		},
+		Spec: cp.Spec.PolicySpec,
+	}
+	if ns := cp.Status.NamespaceStatus(namespace); ns != nil && ns.Since != nil {
+		p.CreationTimestamp = *ns.Since
+	}
+	sp, err := a.statePolicy(cp, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if sp != nil {
+		p.Status = *sp.Status.DeepCopy()
+	}
+	return p, nil
+}
+
+// isStatePolicy reports whether p is the state Policy of a cluster policy,
+// which the cluster policy writes and which is not evaluated on its own.
+func isStatePolicy(p *api.Policy) bool {
+	ref := metav1.GetControllerOf(p)
+	return ref != nil && ref.Kind == "ClusterPolicy" && strings.HasPrefix(ref.APIVersion, api.SchemeGroupVersion.Group+"/")
+}
+
+// statePolicy returns the Policy cp keeps its state in, in namespace, or nil
+// if there is none yet.
+func (a *TimebasedController) statePolicy(cp *api.ClusterPolicy, namespace string) (*api.Policy, error) {
+	sp, err := a.policyLister.Policies(namespace).Get(api.ClusterPolicyPrefix + cp.Name)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ref := metav1.GetControllerOf(sp); ref == nil || ref.UID != cp.UID {
+		return nil, fmt.Errorf("policy %s/%s is not controlled by the cluster policy", namespace, sp.Name)
+	}
+	return sp, nil
+}
+
+// writeStatePolicy writes status to the state Policy of cp in namespace,
+// creating it the first time. Its spec follows the one of cp, for reference.
+func (a *TimebasedController) writeStatePolicy(cp *api.ClusterPolicy, namespace string, status api.PolicyStatus) error {
+	sp, err := a.statePolicy(cp, namespace)
+	if err != nil {
+		return err
+	}
+	policies := a.cfg.PolicyClient.IcpV1beta2().Policies(namespace)
+	switch {
+	case sp == nil:
+		sp = &api.Policy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      api.ClusterPolicyPrefix + cp.Name,
+				Namespace: namespace,
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(cp, api.SchemeGroupVersion.WithKind("ClusterPolicy")),
+				},
+			},
+			Spec: *cp.Spec.PolicySpec.DeepCopy(),
+		}
+		glog.V(2).Infof("cluster policy %s creates its state policy in namespace %s", cp.Name, namespace)
+		if sp, err = policies.Create(sp); err != nil {
+			return err
+		}
+		if err := a.policyInformer.GetIndexer().Update(sp); err != nil {
+			return err
+		}
+	case !equality.Semantic.DeepEqual(sp.Spec, cp.Spec.PolicySpec):
+		sp = sp.DeepCopy()
+		sp.Spec = *cp.Spec.PolicySpec.DeepCopy()
+		if sp, err = policies.Update(sp); err != nil {
+			return err
+		}
+		if err := a.policyInformer.GetIndexer().Update(sp); err != nil {
+			return err
+		}
+	}
+	if equality.Semantic.DeepEqual(sp.Status, status) {
+		return nil
+	}
+	return a.updatePolicyStatus(sp, status)
+}
+
+// deleteStatePolicy deletes the state Policy of cp in namespace, once cp is
+// released from it.
+func (a *TimebasedController) deleteStatePolicy(cp *api.ClusterPolicy, namespace string) error {
+	sp, err := a.statePolicy(cp, namespace)
+	if err != nil || sp == nil {
+		return err
+	}
+	err = a.cfg.PolicyClient.IcpV1beta2().Policies(namespace).Delete(sp.Name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return a.policyInformer.GetIndexer().Delete(sp)
+}
+
+// finishNamespace keeps status, the state of the cluster policy cp in the
+// namespace evals were computed for, in its state Policy there, and returns
+// the summary of it.
+func (a *TimebasedController) finishNamespace(cp *api.ClusterPolicy, evals []*evaluation, status api.PolicyStatus) api.NamespaceStatus {
+	p := evals[0].policy
+	since := p.CreationTimestamp
+	ns := api.NamespaceStatus{
+		Name:    p.Namespace,
+		Since:   &since,
+		Policy:  api.ClusterPolicyPrefix + cp.Name,
+		Applied: hasAppliedWindows(&status),
+	}
+	for _, ws := range status.Windows {
+		if ws.Active {
+			ns.ActiveWindows = append(ns.ActiveWindows, ws.Name)
+		}
+	}
+	if err := a.writeStatePolicy(cp, p.Namespace, status); err != nil {
+		glog.Errorf("failed to update the state of cluster policy %s in namespace %s: %v", cp.Name, p.Namespace, err)
+	}
+	return ns
+}
+
+// finishClusterPolicy writes the status of the cluster policy ce was
+// computed for: the full state in each namespace goes to its state Policy
+// there, and a summary of it to the status of the cluster policy.
+func (a *TimebasedController) finishClusterPolicy(ce *clusterEvaluation) {
+	cp := ce.policy
+	status := api.ClusterPolicyStatus{Overridden: ce.overridden}
+	for _, evals := range ce.namespaces {
+		status.Namespaces = append(status.Namespaces, a.finishNamespace(cp, evals, mergeStatus(evals)))
+	}
+	// A released namespace is reported until nothing is left to undo in it.
+	for name, evals := range ce.releases {
+		released := mergeStatus(evals)
+		if a.released(evals, &released) {
+			err := a.deleteStatePolicy(cp, name)
+			if err == nil {
+				glog.V(2).Infof("cluster policy %s has been released from namespace %s", cp.Name, name)
+				continue
+			}
+			glog.Errorf("failed to delete the state policy of cluster policy %s in namespace %s: %v", cp.Name, name, err)
+		}
+		ns := a.finishNamespace(cp, evals, released)
+		ns.Releasing = true
+		status.Namespaces = append(status.Namespaces, ns)
+	}
+	status.Namespaces = append(status.Namespaces, ce.kept...)
+	sort.Slice(status.Namespaces, func(i, j int) bool { return status.Namespaces[i].Name < status.Namespaces[j].Name })
+
+	if !equality.Semantic.DeepEqual(cp.Status, status) {
+		if err := a.updateClusterPolicyStatus(cp, status); err != nil {
+			glog.Errorf("failed to update status of cluster policy %s: %v", cp.Name, err)
+			return
+		}
+	}
+	if cp.DeletionTimestamp != nil && len(status.Namespaces) == 0 {
+		glog.V(2).Infof("cluster policy %s has been released, removing its finalizer", cp.Name)
+		if err := a.removeClusterPolicyFinalizer(cp); err != nil {
+			glog.Errorf("failed to remove the finalizer of cluster policy %s: %v", cp.Name, err)
+		}
+	}
+}
+
+// updateClusterPolicyStatus writes status back through the
+// clusterpolicies/status subresource, retrying a conflicting write against
+// the latest copy. The controller is the only writer of the status, so the
+// conflict can only come from a change to the spec.
+func (a *TimebasedController) updateClusterPolicyStatus(cp *api.ClusterPolicy, status api.ClusterPolicyStatus) error {
+	policy := cp.DeepCopy()
+	for i := 0; ; i++ {
+		policy.Status = status
+		result, err := a.cfg.PolicyClient.IcpV1beta2().ClusterPolicies().UpdateStatus(policy)
+		if err == nil {
+			return a.clusterPolicyInformer.GetIndexer().Update(result)
+		}
+		if !errors.IsConflict(err) || i >= statusUpdateRetries {
+			return err
+		}
+
+		policy, err = a.cfg.PolicyClient.IcpV1beta2().ClusterPolicies().Get(cp.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+	}
+}
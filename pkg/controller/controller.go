@@ -2,43 +2,81 @@ package controller
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/golang/glog"
-        metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"github.com/robfig/cron"
-	"k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/fields"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
-	extensionsclient "k8s.io/client-go/kubernetes/typed/extensions/v1beta1"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 
-	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1"
+	"github.com/hchenxa/timebase/pkg/activator"
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"github.com/hchenxa/timebase/pkg/client/clientset/versioned"
+	informers "github.com/hchenxa/timebase/pkg/client/informers/externalversions"
+	listers "github.com/hchenxa/timebase/pkg/client/listers/icp/v1beta2"
+	"github.com/hchenxa/timebase/pkg/cronjob"
+	"github.com/hchenxa/timebase/pkg/hpa"
+	"github.com/hchenxa/timebase/pkg/object"
+	"github.com/hchenxa/timebase/pkg/scale"
+	"github.com/hchenxa/timebase/pkg/schedule"
 )
 
-// PolicyLister is to store list of policies
-type PolicyLister struct {
-	cache.Store
-}
+// statusUpdateRetries is the number of times a conflicting status update is
+// retried against a freshly fetched policy.
+const statusUpdateRetries = 5
 
 // Configuration is the controller configuration
 type Configuration struct {
-	RESTClient   *rest.RESTClient
+	PolicyClient versioned.Interface
 	Client       *kubernetes.Clientset
-	Scheme       *runtime.Scheme
 	ResyncPeriod time.Duration
+	// Activator, if set, serves the Services of sleeping namespaces.
+	Activator *activator.Activator
 }
 
 // TimebasedController is the controller for time based auto scaling
 type TimebasedController struct {
 	cfg *Configuration
 
-	scaleNamespacer  extensionsclient.ScalesGetter
-	policyController cache.Controller
-	policyLister     PolicyLister
+	scales          scale.Interface
+	hpas            hpa.Interface
+	objects         object.Interface
+	informerFactory informers.SharedInformerFactory
+	policyInformer  cache.SharedIndexInformer
+	policyLister    listers.PolicyLister
+
+	clusterPolicyInformer cache.SharedIndexInformer
+	clusterPolicyLister   listers.ClusterPolicyLister
+
+	cronJobs            cronjob.Interface
+	hibernationInformer cache.SharedIndexInformer
+	hibernationLister   listers.HibernationLister
+
+	// namespaceInformer caches the namespaces cluster policies select.
+	namespaceInformer cache.SharedIndexInformer
+
+	// endpointsInformer and podInformer cache what tells when the target of
+	// a traffic shift is ready for its traffic, and when the capacity a rule
+	// or window asked for is.
+	endpointsInformer cache.SharedIndexInformer
+	podInformer       cache.SharedIndexInformer
+	// podSelectors holds the pod selectors of the targets whose capacity is
+	// tracked, by policy and target, so that their scale is read only once.
+	podSelectors map[string]labels.Selector
+
+	// sweeps holds when each sleeping hibernation, by namespace and name,
+	// last swept its namespace.
+	sweeps map[string]time.Time
 
 	stopCh chan struct{}
 }
@@ -48,13 +86,68 @@ func NewTimebasedController(config *Configuration) *TimebasedController {
 	policy := TimebasedController{
 		cfg:    config,
 		stopCh: make(chan struct{}),
+		sweeps: map[string]time.Time{},
+
+		podSelectors: map[string]labels.Selector{},
 	}
 
-	policy.scaleNamespacer = policy.cfg.Client.Extensions()
+	policy.scales = scale.New(policy.cfg.Client)
+	policy.hpas = hpa.New(policy.cfg.Client, policy.cfg.ResyncPeriod)
+	policy.objects = object.New(policy.cfg.Client)
+	policy.cronJobs = cronjob.New(policy.cfg.Client)
+
+	policy.informerFactory = informers.NewSharedInformerFactory(policy.cfg.PolicyClient, policy.cfg.ResyncPeriod)
+	policy.policyInformer = policy.informerFactory.Icp().V1beta2().Policies().Informer()
+	policy.policyLister = policy.informerFactory.Icp().V1beta2().Policies().Lister()
+	policy.clusterPolicyInformer = policy.informerFactory.Icp().V1beta2().ClusterPolicies().Informer()
+	policy.clusterPolicyLister = policy.informerFactory.Icp().V1beta2().ClusterPolicies().Lister()
+	policy.hibernationInformer = policy.informerFactory.Icp().V1beta2().Hibernations().Informer()
+	policy.hibernationLister = policy.informerFactory.Icp().V1beta2().Hibernations().Lister()
 
-	policy.policyLister.Store, policy.policyController = cache.NewInformer(
-		cache.NewListWatchFromClient(policy.cfg.RESTClient, "policies", v1.NamespaceAll, fields.Everything()),
-		&api.Policy{}, policy.cfg.ResyncPeriod, cache.ResourceEventHandlerFuncs{})
+	namespaces := policy.cfg.Client.CoreV1().Namespaces()
+	policy.namespaceInformer = cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return namespaces.List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return namespaces.Watch(options)
+			},
+		},
+		&corev1.Namespace{},
+		policy.cfg.ResyncPeriod,
+		cache.Indexers{},
+	)
+
+	endpoints := policy.cfg.Client.CoreV1().Endpoints(metav1.NamespaceAll)
+	policy.endpointsInformer = cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return endpoints.List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return endpoints.Watch(options)
+			},
+		},
+		&corev1.Endpoints{},
+		policy.cfg.ResyncPeriod,
+		cache.Indexers{},
+	)
+
+	pods := policy.cfg.Client.CoreV1().Pods(metav1.NamespaceAll)
+	policy.podInformer = cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return pods.List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return pods.Watch(options)
+			},
+		},
+		&corev1.Pod{},
+		policy.cfg.ResyncPeriod,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+	)
 
 	return &policy
 }
@@ -62,7 +155,15 @@ func NewTimebasedController(config *Configuration) *TimebasedController {
 // Run method start the controller
 func (a *TimebasedController) Run(stopCh <-chan struct{}) {
 	// Start controller
-	go a.policyController.Run(stopCh)
+	a.informerFactory.Start(stopCh)
+	go a.hpas.Run(stopCh)
+	go a.namespaceInformer.Run(stopCh)
+	go a.endpointsInformer.Run(stopCh)
+	go a.podInformer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, a.policyInformer.HasSynced, a.clusterPolicyInformer.HasSynced, a.hibernationInformer.HasSynced, a.hpas.HasSynced, a.namespaceInformer.HasSynced, a.endpointsInformer.HasSynced, a.podInformer.HasSynced) {
+		glog.Errorf("timed out waiting for the policy cache to sync")
+		return
+	}
 	// start a single worker (we may wish to start more in the future)
 	go wait.Until(a.worker, time.Second, stopCh)
 
@@ -71,27 +172,157 @@ func (a *TimebasedController) Run(stopCh <-chan struct{}) {
 
 func (a *TimebasedController) worker() {
 
-	pl := a.policyLister.Store.List()
+	pl, err := a.policyLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("failed to list policies: %v", err)
+		return
+	}
+
+	now := time.Now()
+	asleep := sets.NewString()
+	hl, err := a.hibernationLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("failed to list hibernations: %v", err)
+	}
+	for _, h := range hl {
+		if a.reconcileHibernation(h, now) {
+			asleep.Insert(h.Namespace)
+		}
+	}
+	for key := range a.sweeps {
+		if ns, _, _ := cache.SplitMetaNamespaceKey(key); !asleep.Has(ns) {
+			delete(a.sweeps, key)
+		}
+	}
+
+	var all []*evaluation
+	perPolicy := make([][]*evaluation, 0, len(pl))
+	releases := map[*api.Policy][]*evaluation{}
+	overrides := map[string]sets.String{}
+	for _, p := range pl {
+		if isStatePolicy(p) {
+			// Written by its cluster policy, which is evaluated on its own.
+			continue
+		}
+		if p.DeletionTimestamp != nil {
+			if !hasFinalizer(&p.ObjectMeta) {
+				continue
+			}
+			// The windows of a deleted policy are undone before it goes.
+			evals, err := a.evaluateRelease(p, now)
+			if err != nil {
+				glog.Errorf("failed to resolve the targets of deleted policy %s/%s: %v", p.Namespace, p.Name, err)
+				continue
+			}
+			releases[p] = evals
+			all = append(all, evals...)
+			continue
+		}
+		if len(p.Spec.Overrides) > 0 {
+			if overrides[p.Namespace] == nil {
+				overrides[p.Namespace] = sets.NewString()
+			}
+			overrides[p.Namespace].Insert(p.Spec.Overrides...)
+		}
+		if len(p.Spec.Rules) == 0 && len(p.Spec.Windows) == 0 && !hasAppliedWindows(&p.Status) {
+			// Made only of overrides, the policy has nothing to scale.
+			continue
+		}
+		if needsFinalizer(p) && !hasFinalizer(&p.ObjectMeta) {
+			added, err := a.addPolicyFinalizer(p)
+			if err != nil {
+				glog.Errorf("failed to add the finalizer of policy %s/%s: %v", p.Namespace, p.Name, err)
+				continue
+			}
+			p = added
+		}
+		evals, err := a.evaluateTargets(p, now)
+		if err != nil {
+			glog.Errorf("failed to resolve the targets of policy %s/%s: %v", p.Namespace, p.Name, err)
+			continue
+		}
+		perPolicy = append(perPolicy, evals)
+		all = append(all, evals...)
+	}
+
+	cpl, err := a.clusterPolicyLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("failed to list cluster policies: %v", err)
+	}
+	clusterEvals := make([]*clusterEvaluation, 0, len(cpl))
+	for _, cp := range cpl {
+		if cp.DeletionTimestamp != nil && !hasFinalizer(&cp.ObjectMeta) {
+			continue
+		}
+		if cp.DeletionTimestamp == nil && clusterPolicyNeedsFinalizer(cp) && !hasFinalizer(&cp.ObjectMeta) {
+			added, err := a.addClusterPolicyFinalizer(cp)
+			if err != nil {
+				glog.Errorf("failed to add the finalizer of cluster policy %s: %v", cp.Name, err)
+				continue
+			}
+			cp = added
+		}
+		ce, err := a.evaluateClusterPolicy(cp, overrides, now)
+		if err != nil {
+			glog.Errorf("failed to resolve the namespaces of cluster policy %s: %v", cp.Name, err)
+			continue
+		}
+		clusterEvals = append(clusterEvals, ce)
+		for _, evals := range ce.namespaces {
+			all = append(all, evals...)
+		}
+		for _, evals := range ce.releases {
+			all = append(all, evals...)
+		}
+	}
 
-	// policies := pl.Items
-	// glog.Infof("the policy list was: %s", pl.string)
-	for _, pIf := range pl {
-		p := pIf.(*api.Policy)
-		a.reconcileAutoscaler(p, time.Now())
+	for _, group := range groupByTarget(all) {
+		if asleep.Has(group[0].policy.Namespace) {
+			// The schedule times of a sleeping namespace pass unused, so
+			// that they do not undo the hibernation when it wakes up.
+			for _, e := range group {
+				e.markHandled()
+			}
+			continue
+		}
+		a.reconcileTarget(group)
+	}
+	for _, evals := range perPolicy {
+		a.applyManifests(evals[0])
+		a.applyNodeMaintenance(evals[0])
+		a.applyQuotas(evals[0])
+		a.finishPolicy(evals)
+	}
+	for p, evals := range releases {
+		a.applyManifests(evals[0])
+		a.applyNodeMaintenance(evals[0])
+		a.applyQuotas(evals[0])
+		a.finishRelease(p, evals)
+	}
+	for _, ce := range clusterEvals {
+		for _, evals := range ce.namespaces {
+			a.applyManifests(evals[0])
+			a.applyQuotas(evals[0])
+		}
+		for _, evals := range ce.releases {
+			a.applyManifests(evals[0])
+			a.applyQuotas(evals[0])
+		}
+		a.finishClusterPolicy(ce)
 	}
 
 }
 
-func getRecentUnmetScheduleTimes(p *api.Policy, now time.Time) ([]time.Time, error) {
+func getRecentUnmetScheduleTimes(p *api.Policy, rule *api.PolicyRule, now time.Time) ([]time.Time, error) {
 	starts := []time.Time{}
-	sched, err := cron.ParseStandard(p.Spec.Schedule)
+	sched, err := schedule.Parse(rule.Schedule, p.Spec.TimeZone)
 	if err != nil {
-		return starts, fmt.Errorf("Unparseable schedule: %s : %s", p.Spec.Schedule, err)
+		return starts, err
 	}
 
 	var earliestTime time.Time
-	if p.Spec.Status.LastScheduleTime != nil {
-		earliestTime = p.Spec.Status.LastScheduleTime.Time
+	if rs := p.Status.RuleStatus(rule.Name); rs != nil && rs.LastScheduleTime != nil {
+		earliestTime = rs.LastScheduleTime.Time
 	} else {
 		earliestTime = p.ObjectMeta.CreationTimestamp.Time
 	}
@@ -99,7 +330,7 @@ func getRecentUnmetScheduleTimes(p *api.Policy, now time.Time) ([]time.Time, err
 		return []time.Time{}, nil
 	}
 
-	for t := sched.Next(earliestTime); !t.After(now); t = sched.Next(t) {
+	for t := sched.Next(earliestTime); !t.IsZero() && !t.After(now); t = sched.Next(t) {
 		starts = append(starts, t)
 
 		if len(starts) > 100 {
@@ -110,53 +341,311 @@ func getRecentUnmetScheduleTimes(p *api.Policy, now time.Time) ([]time.Time, err
 	return starts, nil
 }
 
-func (a *TimebasedController) reconcileAutoscaler(p *api.Policy, now time.Time) {
+func getNextScheduleTime(p *api.Policy, rule *api.PolicyRule, now time.Time) (time.Time, error) {
+	sched, err := schedule.Parse(rule.Schedule, p.Spec.TimeZone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := sched.Next(now)
+	if next.IsZero() {
+		return next, fmt.Errorf("schedule %q of rule %s never fires", rule.Schedule, rule.Name)
+	}
+	return next, nil
+}
+
+// reconcileTarget brings the target shared by evals to the state their
+// policies ask for together. Rules fire on their schedule: of all unmet
+// schedule times of the target only the most recent one is applied, the
+// others have been superseded. Windows are level triggered: the scales they
+// ask for are combined on every pass, and the target is corrected whenever it
+// differs.
+func (a *TimebasedController) reconcileTarget(evals []*evaluation) {
+	first := evals[0]
+	reference := fmt.Sprintf("%s/%s/%s", first.target.Kind, first.policy.Namespace, first.target.Name)
 
-	reference := fmt.Sprintf("%s/%s/%s", p.Spec.ScaleTargetRef.Kind, p.ObjectMeta.Namespace, p.Spec.ScaleTargetRef.Name)
+	// Windows that do not scale the target act on it on their own.
+	for _, e := range evals {
+		a.applyWindows(e, reference)
+		a.trackRollout(e, reference)
+		a.trackCapacity(e, reference)
+	}
 
-	scale, err := a.scaleNamespacer.Scales(p.ObjectMeta.Namespace).Get(p.Spec.ScaleTargetRef.Kind, p.Spec.ScaleTargetRef.Name)
+	// An autoscaler would undo any change to the scale of its target, so
+	// its bounds are changed instead.
+	h, err := a.hpas.Find(first.policy.Namespace, *first.target)
 	if err != nil {
-		glog.Errorf("failed to query scale subresource for %s: %v", reference, err)
+		glog.Errorf("failed to look up the autoscaler of %s: %v", reference, err)
+		for _, e := range evals {
+			e.err = err
+		}
 		return
 	}
 
-	times, err := getRecentUnmetScheduleTimes(p, now)
-	if err != nil {
-		glog.Errorf("Cannot determine needs to be started: %v", err)
+	// Windows hold the target at their scale on every pass, so they take
+	// precedence over scaling rules: a rule that fires while they do is
+	// skipped rather than undone a second later.
+	chosen, combineErr := combineReplicas(evals)
+
+	var due *evaluation
+	for _, e := range evals {
+		if e.due == nil {
+			continue
+		}
+		if due == nil || e.dueTime.After(due.dueTime) || e.dueTime.Equal(due.dueTime) && e.policy.Spec.Priority > due.policy.Spec.Priority {
+			due = e
+		}
 	}
-	// TODO: handle multiple unmet start times, from oldest to newest, updating status as needed.
-	if len(times) <= 0 {
+	switch {
+	case due == nil:
 		glog.V(4).Infof("No unmet start times")
+	case chosen != nil && due.due.Action != api.Restart:
+		skipped := fmt.Sprintf("window %s of policy %s/%s holds the target", chosen.window.Name, chosen.policy.Namespace, chosen.policy.Name)
+		glog.V(2).Infof("rule %s of policy %s/%s does not scale %s: %s", due.due.Name, due.policy.Namespace, due.policy.Name, reference, skipped)
+		if rs := due.status.RuleStatus(due.due.Name); rs != nil {
+			rs.Skipped = skipped
+		}
+		for _, e := range evals {
+			e.markHandled()
+		}
+	default:
+		glog.V(4).Infof("Multiple unmet start times so only starting last one")
+		if rs := due.status.RuleStatus(due.due.Name); rs != nil {
+			rs.Skipped = ""
+		}
+		if err := a.applyRule(due, h, reference); err != nil {
+			glog.Errorf("failed to rescale %s: %v", reference, err)
+			due.err = err
+			return
+		}
+		// The schedules have been handled, record them even if no rescale
+		// was needed so that they do not fire again after a restart.
+		for _, e := range evals {
+			e.markHandled()
+		}
+	}
+
+	var applied, previous *int32
+	if combineErr != nil {
+		glog.Errorf("Cannot combine the policies of %s: %v", reference, combineErr)
+	} else if h != nil {
+		a.boundAutoscaler(evals, chosen, h, reference)
+	} else if chosen != nil {
+		replicas := *chosen.replicas
+		for _, e := range evals {
+			if hasScaleWindows(e.policy) {
+				r := replicas
+				e.status.DesiredReplicas = &r
+			}
+		}
+		if prev, err := a.scaleTo(first, replicas, reference); err != nil {
+			glog.Errorf("failed to rescale %s: %v", reference, err)
+			for _, e := range evals {
+				e.err = err
+			}
+		} else {
+			applied, previous = &replicas, &prev
+		}
+	}
+	recordOriginalReplicas(evals, applied, previous)
+	for _, e := range evals {
+		e.requestWindowCapacity()
+	}
+}
+
+// finishPolicy writes the status of the policy evals were computed for.
+func (a *TimebasedController) finishPolicy(evals []*evaluation) {
+	p := evals[0].policy
+	status := mergeStatus(evals)
+	if equality.Semantic.DeepEqual(p.Status, status) {
 		return
 	}
+	if err := a.updatePolicyStatus(p, status); err != nil {
+		glog.Errorf("failed to update status of policy %s/%s: %v", p.Namespace, p.Name, err)
+	}
+}
 
-	glog.V(4).Infof("Multiple unmet start times so only starting last one")
+// mergeStatus returns the status of the policy evals were computed for. The
+// evaluations of the targets a selector matches are merged: a schedule time
+// counts as handled once it is handled for any target, and the replica
+// counts of each target go to its own status.
+func mergeStatus(evals []*evaluation) api.PolicyStatus {
+	p := evals[0].policy
+	status := *evals[0].status.DeepCopy()
+	if p.Spec.TargetSelector != nil {
+		status.DesiredReplicas, status.BaselineReplicas, status.AppliedReplicas, status.OriginalReplicas = nil, nil, nil, nil
+		status.OriginalHorizontalPodAutoscaler, status.AppliedWindows, status.Rollout = nil, nil, nil
+		for _, e := range evals {
+			for i, rs := range e.status.Rules {
+				last := &status.Rules[i].LastScheduleTime
+				if rs.LastScheduleTime != nil && (*last == nil || rs.LastScheduleTime.Time.After((*last).Time)) {
+					*last = rs.LastScheduleTime.DeepCopy()
+				}
+				if rs.Skipped != "" {
+					status.Rules[i].Skipped = rs.Skipped
+				}
+				if slowerCapacity(status.Rules[i].Capacity, rs.Capacity) {
+					status.Rules[i].LeadStatus = *rs.LeadStatus.DeepCopy()
+				}
+			}
+			for i, ws := range e.status.Windows {
+				if slowerCapacity(status.Windows[i].Capacity, ws.Capacity) {
+					status.Windows[i].LeadStatus = *ws.LeadStatus.DeepCopy()
+				}
+			}
+			if e.target != nil {
+				status.Targets = append(status.Targets, e.targetStatus())
+			}
+		}
+	}
 
-	currentReplicas := scale.Status.Replicas
+	for _, rs := range status.Rules {
+		if rs.LastScheduleTime != nil && (status.LastScheduleTime == nil || rs.LastScheduleTime.Time.After(status.LastScheduleTime.Time)) {
+			status.LastScheduleTime = rs.LastScheduleTime.DeepCopy()
+		}
+		if rs.NextScheduleTime != nil && (status.NextScheduleTime == nil || rs.NextScheduleTime.Time.Before(status.NextScheduleTime.Time)) {
+			status.NextScheduleTime = rs.NextScheduleTime.DeepCopy()
+		}
+	}
+	return status
+}
 
-	if p.Spec.Action == api.ScaleUp {
-		if p.Spec.TargetReplicas <= currentReplicas {
-			glog.V(4).Infof("The request replicas was less than current replicas, no need to scale up")
-		} else {
-			scale.Spec.Replicas = p.Spec.TargetReplicas
-			_, err = a.scaleNamespacer.Scales(p.ObjectMeta.Namespace).Update(p.Spec.ScaleTargetRef.Kind, scale)
-			if err != nil {
-				glog.Errorf("failed to rescale %s: %v", reference, err)
-				return
+// evaluateTargets evaluates p at now for every object it scales. A selector
+// is resolved afresh on every pass, so objects that gain or lose its labels
+// are picked up or dropped. When it matches nothing a single evaluation
+// without a target is returned, whose schedule times pass unused.
+func (a *TimebasedController) evaluateTargets(p *api.Policy, now time.Time) ([]*evaluation, error) {
+	base := evaluatePolicy(p, now)
+	ts := p.Spec.TargetSelector
+	if ts == nil {
+		if p.Spec.ScaleTargetRef == nil {
+			if !needsTarget(p) {
+				return []*evaluation{base}, nil
 			}
-			p.Spec.Status.LastScheduleTime = &metav1.Time{Time: now}
+			return nil, fmt.Errorf("neither a scaleTargetRef nor a targetSelector is set")
 		}
-	} else {
-		if p.Spec.TargetReplicas >= currentReplicas {
-			glog.V(4).Infof("the request replicas was large than replicas, no need to scale down")
-		} else {
-			scale.Spec.Replicas = p.Spec.TargetReplicas
-			_, err = a.scaleNamespacer.Scales(p.ObjectMeta.Namespace).Update(p.Spec.ScaleTargetRef.Kind, scale)
-			if err != nil {
-				glog.Errorf("failed to rescale %s: %v", reference, err)
-				return
+		base.target = p.Spec.ScaleTargetRef
+		base.claim()
+		return []*evaluation{base}, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&ts.Selector)
+	if err != nil {
+		return nil, err
+	}
+	names, err := a.objects.List(p.Namespace, ts.APIVersion, ts.Kind, selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		base.markHandled()
+		return []*evaluation{base}, nil
+	}
+	sort.Strings(names)
+	evals := make([]*evaluation, 0, len(names))
+	for _, name := range names {
+		e := base.forTarget(autoscaling.CrossVersionObjectReference{APIVersion: ts.APIVersion, Kind: ts.Kind, Name: name})
+		e.claim()
+		evals = append(evals, e)
+	}
+	return evals, nil
+}
+
+// evaluatePolicy computes the state of the rules and windows of p at now.
+func evaluatePolicy(p *api.Policy, now time.Time) *evaluation {
+	e := &evaluation{policy: p, unmet: map[string]time.Time{}}
+	e.status.BaselineReplicas = copyReplicas(p.Status.BaselineReplicas)
+	e.status.AppliedReplicas = copyReplicas(p.Status.AppliedReplicas)
+	e.status.OriginalReplicas = copyReplicas(p.Status.OriginalReplicas)
+	e.status.OriginalHorizontalPodAutoscaler = p.Status.OriginalHorizontalPodAutoscaler.DeepCopy()
+	e.status.AppliedWindows = copyAppliedWindows(p.Status.AppliedWindows)
+	e.status.Rollout = p.Status.Rollout.DeepCopy()
+	for _, m := range p.Status.Manifests {
+		e.status.Manifests = append(e.status.Manifests, *m.DeepCopy())
+	}
+	for _, m := range p.Status.NodeMaintenance {
+		e.status.NodeMaintenance = append(e.status.NodeMaintenance, *m.DeepCopy())
+	}
+	for _, q := range p.Status.Quotas {
+		e.status.Quotas = append(e.status.Quotas, *q.DeepCopy())
+	}
+	for i := range p.Spec.Rules {
+		rule := &p.Spec.Rules[i]
+		rs := api.RuleStatus{Name: rule.Name}
+		if old := p.Status.RuleStatus(rule.Name); old != nil {
+			rs.LastScheduleTime = old.LastScheduleTime.DeepCopy()
+			rs.Skipped = old.Skipped
+			if hasLead(&rule.Lead) {
+				rs.LeadStatus = *old.LeadStatus.DeepCopy()
 			}
-			p.Spec.Status.LastScheduleTime = &metav1.Time{Time: now}
+		}
+		// A rule with a lead time fires as if it were that much later.
+		at := now.Add(setLeadTime(&rule.Lead, &rs.LeadStatus))
+
+		times, err := getRecentUnmetScheduleTimes(p, rule, at)
+		if err != nil {
+			glog.Errorf("Cannot determine needs to be started: %v", err)
+		}
+		if len(times) > 0 {
+			last := times[len(times)-1]
+			e.unmet[rule.Name] = last
+			// Maintenance rules act on nodes, applyNodeMaintenance
+			// starts their runs.
+			if rule.Action != api.MaintainNodes && (e.due == nil || last.After(e.dueTime)) {
+				e.due, e.dueTime = rule, last
+			}
+		}
+		if next, err := getNextScheduleTime(p, rule, at); err != nil {
+			glog.Errorf("Cannot determine next schedule time: %v", err)
+		} else {
+			rs.NextScheduleTime = &metav1.Time{Time: next}
+		}
+		e.status.Rules = append(e.status.Rules, rs)
+	}
+
+	for i := range p.Spec.Windows {
+		w := &p.Spec.Windows[i]
+		var ls api.LeadStatus
+		if old := p.Status.WindowStatus(w.Name); old != nil && hasLead(&w.Lead) {
+			ls = *old.LeadStatus.DeepCopy()
+		}
+		ws, err := getWindowStatus(p, w, now, setLeadTime(&w.Lead, &ls))
+		if err != nil {
+			glog.Errorf("Cannot determine window state: %v", err)
+			continue
+		}
+		ws.LeadStatus = ls
+		e.status.Windows = append(e.status.Windows, ws)
+	}
+	e.window, e.active = getDecidingWindow(p, e.status.Windows)
+	e.status.NextScheduleTime = nextWindowTransition(e.status.Windows)
+	return e
+}
+
+// updatePolicyStatus writes status back through the policies/status
+// subresource. The update carries the resourceVersion of the policy, so a
+// conflicting write is detected by the apiserver; in that case the latest
+// copy is fetched and status is written on top of it. The controller is the
+// only writer of the status, so the conflict can only come from a change to
+// the spec, and status records what this pass changed, which must not be
+// lost.
+func (a *TimebasedController) updatePolicyStatus(p *api.Policy, status api.PolicyStatus) error {
+	policy := p.DeepCopy()
+	for i := 0; ; i++ {
+		policy.Status = status
+		result, err := a.cfg.PolicyClient.IcpV1beta2().Policies(policy.Namespace).UpdateStatus(policy)
+		if err == nil {
+			// Keep the cache in line with the apiserver until the watch
+			// delivers the update, otherwise the next worker pass would see
+			// the stale status and fire the schedule again.
+			return a.policyInformer.GetIndexer().Update(result)
+		}
+		if !errors.IsConflict(err) || i >= statusUpdateRetries {
+			return err
+		}
+
+		policy, err = a.cfg.PolicyClient.IcpV1beta2().Policies(p.Namespace).Get(p.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
 		}
 	}
 }
@@ -0,0 +1,418 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/hchenxa/timebase/pkg/activator"
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"github.com/hchenxa/timebase/pkg/schedule"
+)
+
+// defaultIdleTimeout is how long a workload woken up by the activator stays
+// up without requests when the hibernation does not say.
+const defaultIdleTimeout = 10 * time.Minute
+
+// reconcileHibernation puts the namespace of h to sleep or wakes it up,
+// depending on which of its schedules activated last, and reports whether
+// the namespace is asleep. Like windows, hibernations are level triggered:
+// workloads and CronJobs created or changed while the namespace sleeps are
+// put to sleep on the next pass.
+func (a *TimebasedController) reconcileHibernation(h *api.Hibernation, now time.Time) bool {
+	key := h.Namespace + "/" + h.Name
+	if h.DeletionTimestamp != nil {
+		delete(a.sweeps, key)
+		if hasFinalizer(&h.ObjectMeta) {
+			a.releaseHibernation(h)
+		}
+		return false
+	}
+	if !hasFinalizer(&h.ObjectMeta) {
+		added, err := a.addHibernationFinalizer(h)
+		if err != nil {
+			glog.Errorf("failed to add the finalizer of hibernation %s/%s: %v", h.Namespace, h.Name, err)
+			return false
+		}
+		h = added
+	}
+
+	status := h.Status.DeepCopy()
+	err := getHibernationStatus(h, now, status)
+	if err == nil {
+		if status.Asleep {
+			// A workload whose idle timeout is up goes back to sleep right
+			// away.
+			sweep := expireWoken(h, status, now) || a.sweepDue(h, now)
+			var sleepErr error
+			if sweep {
+				sleepErr = a.sleep(h.Namespace, status)
+			}
+			err = utilerrors.NewAggregate([]error{sleepErr, a.routeServices(h, status, sweep, now)})
+			if sweep && err == nil {
+				a.sweeps[key] = now
+			}
+		} else {
+			delete(a.sweeps, key)
+			status.Autoscaled = nil
+			status.Woken = nil
+			err = utilerrors.NewAggregate([]error{a.releaseServices(h.Namespace, status, sets.NewString()), a.wake(h.Namespace, status)})
+		}
+	}
+	status.Error = ""
+	if err != nil {
+		glog.Errorf("failed to reconcile hibernation %s/%s: %v", h.Namespace, h.Name, err)
+		status.Error = err.Error()
+	}
+
+	if !equality.Semantic.DeepEqual(h.Status, *status) {
+		if err := a.updateHibernationStatus(h, *status); err != nil {
+			glog.Errorf("failed to update status of hibernation %s/%s: %v", h.Namespace, h.Name, err)
+		}
+	}
+	return status.Asleep
+}
+
+// releaseHibernation wakes the namespace of the deleted hibernation h up and
+// hands its Services back to their pods. Once nothing recorded in its status
+// is left to undo, it lets the apiserver delete it.
+func (a *TimebasedController) releaseHibernation(h *api.Hibernation) {
+	status := h.Status.DeepCopy()
+	status.Asleep = false
+	status.Autoscaled = nil
+	status.Woken = nil
+	err := utilerrors.NewAggregate([]error{a.releaseServices(h.Namespace, status, sets.NewString()), a.wake(h.Namespace, status)})
+	status.Error = ""
+	if err != nil {
+		glog.Errorf("failed to release deleted hibernation %s/%s: %v", h.Namespace, h.Name, err)
+		status.Error = err.Error()
+	}
+	if !equality.Semantic.DeepEqual(h.Status, *status) {
+		if err := a.updateHibernationStatus(h, *status); err != nil {
+			glog.Errorf("failed to update status of hibernation %s/%s: %v", h.Namespace, h.Name, err)
+			return
+		}
+	}
+	if err != nil || len(status.Workloads) > 0 || len(status.CronJobs) > 0 || len(status.Services) > 0 {
+		return
+	}
+	glog.V(2).Infof("hibernation %s/%s has been released, removing its finalizer", h.Namespace, h.Name)
+	if err := a.removeHibernationFinalizer(h); err != nil {
+		glog.Errorf("failed to remove the finalizer of hibernation %s/%s: %v", h.Namespace, h.Name, err)
+	}
+}
+
+// getHibernationStatus works out into status whether the namespace of h
+// sleeps at now: it does when the sleep schedule activated after the wake
+// schedule did.
+func getHibernationStatus(h *api.Hibernation, now time.Time, status *api.HibernationStatus) error {
+	sleep, err := schedule.Parse(h.Spec.Sleep, h.Spec.TimeZone)
+	if err != nil {
+		return err
+	}
+	wake, err := schedule.Parse(h.Spec.Wake, h.Spec.TimeZone)
+	if err != nil {
+		return err
+	}
+
+	lastSleep, lastWake := lastActivation(sleep, now), lastActivation(wake, now)
+	status.LastSleepTime, status.LastWakeTime = nil, nil
+	if !lastSleep.IsZero() {
+		status.LastSleepTime = &metav1.Time{Time: lastSleep}
+	}
+	if !lastWake.IsZero() {
+		status.LastWakeTime = &metav1.Time{Time: lastWake}
+	}
+	status.Asleep = !lastSleep.IsZero() && lastSleep.After(lastWake)
+
+	status.NextScheduleTime = nil
+	for _, next := range []time.Time{sleep.Next(now), wake.Next(now)} {
+		if !next.IsZero() && (status.NextScheduleTime == nil || next.Before(status.NextScheduleTime.Time)) {
+			status.NextScheduleTime = &metav1.Time{Time: next}
+		}
+	}
+	return nil
+}
+
+// sweepDue reports whether the namespace of h, which sleeps at now, is to be
+// swept for workloads and CronJobs that are awake, and its Services routed to
+// the activator: when it falls asleep, after a sweep failed, and then once
+// per resync period, like the informers of the controller. Sweeping lists
+// every scalable resource in the namespace.
+func (a *TimebasedController) sweepDue(h *api.Hibernation, now time.Time) bool {
+	last, ok := a.sweeps[h.Namespace+"/"+h.Name]
+	return !h.Status.Asleep || !ok || !now.Before(last.Add(a.cfg.ResyncPeriod))
+}
+
+// expireWoken drops the Services woken up on request whose idle timeout is
+// up at now from status, and those h no longer lists. It reports whether
+// any workload is to go back to sleep.
+func expireWoken(h *api.Hibernation, status *api.HibernationStatus, now time.Time) bool {
+	listed := sets.NewString()
+	idle := defaultIdleTimeout
+	if h.Spec.Activator != nil {
+		for _, s := range h.Spec.Activator.Services {
+			listed.Insert(s.Name)
+		}
+		if d := h.Spec.Activator.IdleTimeout; d != nil && d.Duration > 0 {
+			idle = d.Duration
+		}
+	}
+	var woken []api.WokenService
+	expired := false
+	for _, w := range status.Woken {
+		if !listed.Has(w.Name) {
+			continue
+		}
+		if !now.Before(w.WakeTime.Add(idle)) {
+			glog.V(2).Infof("%s/%s/%s has been up for %v, it goes back to sleep", w.ScaleTargetRef.Kind, h.Namespace, w.ScaleTargetRef.Name, idle)
+			expired = true
+			continue
+		}
+		woken = append(woken, w)
+	}
+	status.Woken = woken
+	return expired
+}
+
+// sleep scales every workload in namespace to zero and suspends its
+// CronJobs, recording in status what it changed. Workloads that are at zero
+// as listed are not looked at further. A workload a HorizontalPodAutoscaler
+// scales is left running, as the autoscaler cannot scale it to zero, and is
+// reported in status. So is a workload woken up on request, until its idle
+// timeout is up.
+func (a *TimebasedController) sleep(namespace string, status *api.HibernationStatus) error {
+	workloads, err := a.scales.ListAll(namespace)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	status.Autoscaled = nil
+	for _, w := range workloads {
+		ref := w.CrossVersionObjectReference
+		if w.Replicas != nil && *w.Replicas == 0 {
+			continue
+		}
+		if woken(status, ref) {
+			continue
+		}
+		if h, err := a.hpas.Find(namespace, ref); err != nil {
+			errs = append(errs, err)
+			continue
+		} else if h != nil {
+			glog.V(4).Infof("hibernation leaves %s/%s/%s to its autoscaler %s", ref.Kind, namespace, ref.Name, h.Name)
+			status.Autoscaled = append(status.Autoscaled, ref)
+			continue
+		}
+		scale, err := a.scales.Get(namespace, ref)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if scale.Spec.Replicas == 0 {
+			continue
+		}
+		// A workload scaled up while the namespace sleeps keeps the scale
+		// it had when it was put to sleep first.
+		if status.Workload(ref) == nil {
+			status.Workloads = append(status.Workloads, api.HibernatedWorkload{CrossVersionObjectReference: ref, Replicas: scale.Spec.Replicas})
+		}
+		glog.V(2).Infof("hibernation scales %s/%s/%s from %d to 0", ref.Kind, namespace, ref.Name, scale.Spec.Replicas)
+		scale.Spec.Replicas = 0
+		if _, err := a.scales.Update(namespace, ref, scale); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	jobs, err := a.cronJobs.List(namespace)
+	if err != nil {
+		return utilerrors.NewAggregate(append(errs, err))
+	}
+	suspended := sets.NewString(status.CronJobs...)
+	for _, job := range jobs {
+		if job.Suspend {
+			continue
+		}
+		glog.V(2).Infof("hibernation suspends CronJob/%s/%s", namespace, job.Name)
+		if err := a.cronJobs.SetSuspend(namespace, job.Name, true); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !suspended.Has(job.Name) {
+			status.CronJobs = append(status.CronJobs, job.Name)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// woken reports whether a request woke the workload ref points at up.
+func woken(status *api.HibernationStatus, ref autoscaling.CrossVersionObjectReference) bool {
+	for _, w := range status.Woken {
+		if w.ScaleTargetRef.Kind == ref.Kind && w.ScaleTargetRef.Name == ref.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// wake restores the workloads and resumes the CronJobs recorded in status.
+// A workload that was scaled up by someone else in the meantime is left at
+// its scale. Whatever could not be restored is kept for the next pass.
+func (a *TimebasedController) wake(namespace string, status *api.HibernationStatus) error {
+	var errs []error
+	var workloads []api.HibernatedWorkload
+	for _, w := range status.Workloads {
+		scale, err := a.scales.Get(namespace, w.CrossVersionObjectReference)
+		switch {
+		case errors.IsNotFound(err):
+			continue
+		case err != nil:
+			errs = append(errs, err)
+			workloads = append(workloads, w)
+			continue
+		case scale.Spec.Replicas != 0:
+			continue
+		}
+		glog.V(2).Infof("hibernation restores %s/%s/%s to %d", w.Kind, namespace, w.Name, w.Replicas)
+		scale.Spec.Replicas = w.Replicas
+		if _, err := a.scales.Update(namespace, w.CrossVersionObjectReference, scale); err != nil {
+			errs = append(errs, err)
+			workloads = append(workloads, w)
+		}
+	}
+	status.Workloads = workloads
+
+	var jobs []string
+	for _, name := range status.CronJobs {
+		glog.V(2).Infof("hibernation resumes CronJob/%s/%s", namespace, name)
+		if err := a.cronJobs.SetSuspend(namespace, name, false); err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, err)
+			jobs = append(jobs, name)
+		}
+	}
+	status.CronJobs = jobs
+	return utilerrors.NewAggregate(errs)
+}
+
+// routeServices routes the HTTP ports of the Services the activator of h
+// lists to the activator, and hands back the ones it no longer lists. A
+// request to one of them wakes its workload up to the scale recorded for it,
+// or to one; once it has, the Service is handed back to its pods until the
+// idle timeout is up. Services already routed are only taken again on a
+// sweep. The ports left out are recorded in status.
+func (a *TimebasedController) routeServices(h *api.Hibernation, status *api.HibernationStatus, sweep bool, now time.Time) error {
+	wanted := sets.NewString()
+	if h.Spec.Activator == nil || len(h.Spec.Activator.Services) == 0 {
+		return a.releaseServices(h.Namespace, status, wanted)
+	}
+	if a.cfg.Activator == nil {
+		return fmt.Errorf("the activator is not enabled, start the controller with --activator-address")
+	}
+
+	routed := sets.NewString(status.Services...)
+	taken := sets.NewString()
+	var errs []error
+	var unrouted []string
+	for _, s := range h.Spec.Activator.Services {
+		wanted.Insert(s.Name)
+		if status.WokenService(s.Name) != nil {
+			continue
+		}
+		if routed.Has(s.Name) && a.cfg.Activator.Woken(h.Namespace, s.Name) {
+			glog.V(2).Infof("%s/%s/%s has been woken up, handing Service %s/%s back", s.ScaleTargetRef.Kind, h.Namespace, s.ScaleTargetRef.Name, h.Namespace, s.Name)
+			if err := activator.Release(a.cfg.Client, h.Namespace, s.Name); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			routed.Delete(s.Name)
+			status.Woken = append(status.Woken, api.WokenService{Name: s.Name, ScaleTargetRef: s.ScaleTargetRef, WakeTime: metav1.Time{Time: now}})
+			continue
+		}
+		if routed.Has(s.Name) && !sweep {
+			continue
+		}
+		replicas := int32(1)
+		for _, w := range status.Workloads {
+			if w.Kind == s.ScaleTargetRef.Kind && w.Name == s.ScaleTargetRef.Name {
+				replicas = w.Replicas
+			}
+		}
+		// Services are recorded even when taking them failed half way,
+		// handing back one that was not taken does nothing.
+		routed.Insert(s.Name)
+		taken.Insert(s.Name)
+		ports, err := a.cfg.Activator.Take(h.Namespace, s, replicas)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, p := range ports {
+			unrouted = append(unrouted, s.Name+"/"+p)
+		}
+	}
+	for _, p := range status.UnroutedPorts {
+		if name := strings.SplitN(p, "/", 2)[0]; routed.Has(name) && !taken.Has(name) {
+			unrouted = append(unrouted, p)
+		}
+	}
+	sort.Strings(unrouted)
+	status.UnroutedPorts = unrouted
+	status.Services = routed.List()
+	return utilerrors.NewAggregate(append(errs, a.releaseServices(h.Namespace, status, wanted)))
+}
+
+// releaseServices hands the Services recorded in status back to their pods,
+// except the wanted ones. Services that could not be handed back are kept
+// for the next pass.
+func (a *TimebasedController) releaseServices(namespace string, status *api.HibernationStatus, wanted sets.String) error {
+	if wanted.Len() == 0 {
+		status.UnroutedPorts = nil
+	}
+	var errs []error
+	var services []string
+	for _, name := range status.Services {
+		if wanted.Has(name) {
+			services = append(services, name)
+			continue
+		}
+		if a.cfg.Activator != nil {
+			a.cfg.Activator.Forget(namespace, name)
+		}
+		if err := activator.Release(a.cfg.Client, namespace, name); err != nil {
+			errs = append(errs, err)
+			services = append(services, name)
+		}
+	}
+	status.Services = services
+	return utilerrors.NewAggregate(errs)
+}
+
+// updateHibernationStatus writes status back through the
+// hibernations/status subresource, retrying a conflicting write against the
+// latest copy.
+func (a *TimebasedController) updateHibernationStatus(h *api.Hibernation, status api.HibernationStatus) error {
+	hibernation := h.DeepCopy()
+	for i := 0; ; i++ {
+		hibernation.Status = status
+		result, err := a.cfg.PolicyClient.IcpV1beta2().Hibernations(hibernation.Namespace).UpdateStatus(hibernation)
+		if err == nil {
+			return a.hibernationInformer.GetIndexer().Update(result)
+		}
+		if !errors.IsConflict(err) || i >= statusUpdateRetries {
+			return err
+		}
+
+		hibernation, err = a.cfg.PolicyClient.IcpV1beta2().Hibernations(h.Namespace).Get(h.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+// readyLatencies is how many recent runs the lead time is learned from.
+const readyLatencies = 5
+
+// leadTime returns how long ahead of its schedule a rule or window with lead
+// acts. A learned lead time is the longest time the pods took to become
+// ready in the recent runs recorded in ls; until there are any, and without
+// learning, it is the one set.
+func leadTime(lead *api.Lead, ls *api.LeadStatus) time.Duration {
+	if lead.LearnLeadTime && len(ls.ReadyLatencies) > 0 {
+		var longest time.Duration
+		for _, d := range ls.ReadyLatencies {
+			if d.Duration > longest {
+				longest = d.Duration
+			}
+		}
+		return longest
+	}
+	if lead.LeadTime != nil && lead.LeadTime.Duration > 0 {
+		return lead.LeadTime.Duration
+	}
+	return 0
+}
+
+// hasLead reports whether a rule or window acts ahead of its schedule, and so
+// has the readiness of the capacity it asks for tracked.
+func hasLead(lead *api.Lead) bool {
+	return lead.LearnLeadTime || lead.LeadTime != nil && lead.LeadTime.Duration > 0
+}
+
+// requestCapacity starts tracking when the target has replicas ready pods for
+// the run of a rule or window scheduled at requested. A run that is tracked
+// already keeps the time it was triggered.
+func requestCapacity(ls *api.LeadStatus, requested time.Time, replicas int32) {
+	if c := ls.Capacity; c != nil && c.RequestedTime != nil && c.RequestedTime.Time.Equal(requested) {
+		return
+	}
+	now := metav1.Now()
+	ls.Capacity = &api.CapacityStatus{
+		RequestedTime: &metav1.Time{Time: requested},
+		TriggerTime:   &now,
+		Replicas:      replicas,
+	}
+}
+
+// requestRuleCapacity tracks the capacity the due rule of e asks for, when
+// it fires ahead of its schedule.
+func (e *evaluation) requestRuleCapacity(replicas int32) {
+	if !hasLead(&e.due.Lead) {
+		return
+	}
+	if rs := e.status.RuleStatus(e.due.Name); rs != nil {
+		requestCapacity(&rs.LeadStatus, e.dueTime, replicas)
+	}
+}
+
+// requestWindowCapacity tracks the capacity the open deciding window of e
+// asks for, when it opens ahead of its start.
+func (e *evaluation) requestWindowCapacity() {
+	w := e.window
+	if w == nil || !e.active || e.replicas == nil || !hasLead(&w.Lead) {
+		return
+	}
+	if ws := e.status.WindowStatus(w.Name); ws != nil && ws.StartTime != nil {
+		requestCapacity(&ws.LeadStatus, ws.StartTime.Time, *e.replicas)
+	}
+}
+
+// trackCapacity records when the capacity the rules and windows of e asked
+// for is ready, that is when as many pods of the target as they asked for
+// are ready, and learns the lead time from how long that took. A run whose
+// capacity is not ready by the time the next run of its rule is requested,
+// or its window closes, is no longer tracked.
+func (a *TimebasedController) trackCapacity(e *evaluation, reference string) {
+	var pending []*api.LeadStatus
+	for i := range e.status.Rules {
+		rs := &e.status.Rules[i]
+		c := rs.Capacity
+		if c == nil || c.ReadyTime != nil {
+			continue
+		}
+		if rs.LastScheduleTime != nil && rs.LastScheduleTime.Time.After(c.RequestedTime.Time) {
+			glog.V(2).Infof("%d pods of %s were not ready for rule %s before its next run, no longer waiting for them", c.Replicas, reference, rs.Name)
+			rs.Capacity = nil
+			continue
+		}
+		pending = append(pending, &rs.LeadStatus)
+	}
+	for i := range e.status.Windows {
+		ws := &e.status.Windows[i]
+		c := ws.Capacity
+		if c == nil || c.ReadyTime != nil {
+			continue
+		}
+		if !ws.Active || ws.StartTime == nil || ws.StartTime.Time.After(c.RequestedTime.Time) {
+			glog.V(2).Infof("%d pods of %s were not ready while window %s was open, no longer waiting for them", c.Replicas, reference, ws.Name)
+			ws.Capacity = nil
+			continue
+		}
+		pending = append(pending, &ws.LeadStatus)
+	}
+	key := fmt.Sprintf("%s/%s", targetKey(e), e.policy.Name)
+	if len(pending) == 0 {
+		delete(a.podSelectors, key)
+		return
+	}
+
+	ready, err := a.readyPods(e, key)
+	if err != nil {
+		glog.Warningf("failed to count the ready pods of %s: %v", reference, err)
+		return
+	}
+	now := metav1.Now()
+	for _, ls := range pending {
+		c := ls.Capacity
+		if ready < c.Replicas {
+			continue
+		}
+		c.ReadyTime = &now
+		c.Late = &metav1.Duration{Duration: now.Sub(c.RequestedTime.Time)}
+		glog.V(2).Infof("%d pods of %s are ready %v after they were asked for at %v", c.Replicas, reference, c.Late.Duration, c.RequestedTime.Time)
+		ls.ReadyLatencies = append(ls.ReadyLatencies, metav1.Duration{Duration: now.Sub(c.TriggerTime.Time)})
+		if n := len(ls.ReadyLatencies); n > readyLatencies {
+			ls.ReadyLatencies = ls.ReadyLatencies[n-readyLatencies:]
+		}
+	}
+}
+
+// setLeadTime reports in ls the lead time a rule or window with lead acts
+// with, and returns it.
+func setLeadTime(lead *api.Lead, ls *api.LeadStatus) time.Duration {
+	d := leadTime(lead, ls)
+	ls.LeadTime = nil
+	if d > 0 {
+		ls.LeadTime = &metav1.Duration{Duration: d}
+	}
+	return d
+}
+
+// slowerCapacity reports whether b is a later run than a, or the same run
+// with its capacity ready later, so that a selector policy reports the
+// slowest of its targets.
+func slowerCapacity(a, b *api.CapacityStatus) bool {
+	switch {
+	case b == nil:
+		return false
+	case a == nil:
+		return true
+	case !a.RequestedTime.Time.Equal(b.RequestedTime.Time):
+		return b.RequestedTime.After(a.RequestedTime.Time)
+	case a.ReadyTime == nil:
+		return false
+	}
+	return b.ReadyTime == nil || b.ReadyTime.After(a.ReadyTime.Time)
+}
+
+// readyPods counts the ready pods of the target of e in the pod cache. They
+// are found through the selector its scale subresource reports, which is
+// read once and kept under key while the capacity of the target is tracked.
+func (a *TimebasedController) readyPods(e *evaluation, key string) (int32, error) {
+	selector, ok := a.podSelectors[key]
+	if !ok {
+		scale, err := a.scales.Get(e.policy.Namespace, *e.target)
+		if err != nil {
+			return 0, fmt.Errorf("failed to query scale subresource: %v", err)
+		}
+		if scale.Status.Selector == "" {
+			return 0, fmt.Errorf("the scale subresource does not report a pod selector")
+		}
+		if selector, err = labels.Parse(scale.Status.Selector); err != nil {
+			return 0, err
+		}
+		a.podSelectors[key] = selector
+	}
+	objs, err := a.podInformer.GetIndexer().ByIndex(cache.NamespaceIndex, e.policy.Namespace)
+	if err != nil {
+		return 0, err
+	}
+	var ready int32
+	for _, obj := range objs {
+		pod := obj.(*corev1.Pod)
+		if pod.DeletionTimestamp == nil && selector.Matches(labels.Set(pod.Labels)) && podReady(pod) {
+			ready++
+		}
+	}
+	return ready, nil
+}
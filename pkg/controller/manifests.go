@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"github.com/hchenxa/timebase/pkg/object"
+)
+
+// The labels of the objects created from manifests, which tell them apart
+// from objects created by others and lead back to their window.
+const (
+	policyLabel          = "icp.ibm.com/policy"
+	policyNamespaceLabel = "icp.ibm.com/policy-namespace"
+	windowLabel          = "icp.ibm.com/window"
+)
+
+// applyManifests creates the objects of the open manifests windows of the
+// policy of e, and deletes the ones of windows that have closed or are gone
+// from the spec. Manifests belong to the policy rather than to its targets,
+// so e is the first evaluation of the policy whatever it targets. Like
+// windows they are level triggered: an object deleted while its window is
+// open is created again on the next pass.
+func (a *TimebasedController) applyManifests(e *evaluation) {
+	p := e.policy
+	open := sets.NewString()
+	for _, ws := range e.status.Windows {
+		if w := window(p, ws.Name); ws.Active && w != nil && w.Action == api.ManifestsWindow {
+			open.Insert(ws.Name)
+		}
+	}
+
+	var errs []error
+	for i := range p.Spec.Windows {
+		w := &p.Spec.Windows[i]
+		if !open.Has(w.Name) {
+			continue
+		}
+		applied := e.status.AppliedManifests(w.Name)
+		if applied == nil {
+			e.status.Manifests = append(e.status.Manifests, api.AppliedManifests{Window: w.Name})
+			applied = &e.status.Manifests[len(e.status.Manifests)-1]
+		}
+		if err := a.createManifests(e, w, applied); err != nil {
+			errs = append(errs, fmt.Errorf("window %s: %v", w.Name, err))
+		}
+	}
+
+	var kept []api.AppliedManifests
+	for _, applied := range e.status.Manifests {
+		if open.Has(applied.Window) {
+			kept = append(kept, applied)
+			continue
+		}
+		glog.V(2).Infof("window %s of policy %s/%s has closed, deleting its objects", applied.Window, p.Namespace, p.Name)
+		applied.Objects = a.deleteManifests(p, applied.Objects, &errs)
+		if len(applied.Objects) > 0 {
+			kept = append(kept, applied)
+		}
+	}
+	e.status.Manifests = kept
+
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		glog.Errorf("failed to apply the manifests of policy %s/%s: %v", p.Namespace, p.Name, err)
+		e.err = err
+	}
+}
+
+// createManifests creates the objects of the manifests of the open window w
+// that do not exist, recording them in applied, and deletes the ones it
+// created from manifests that have since been removed from w.
+func (a *TimebasedController) createManifests(e *evaluation, w *api.ScalingWindow, applied *api.AppliedManifests) error {
+	p := e.policy
+	var errs []error
+	wanted := map[autoscaling.CrossVersionObjectReference]bool{}
+	for _, raw := range w.Manifests {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(raw.Raw); err != nil {
+			errs = append(errs, fmt.Errorf("invalid manifest: %v", err))
+			continue
+		}
+		ref := object.Ref(obj)
+		if ref.Name == "" {
+			errs = append(errs, fmt.Errorf("a manifest of kind %s has no name", ref.Kind))
+			continue
+		}
+		wanted[ref] = true
+		if err := a.createManifest(p, w, obj); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %v", ref.Kind, ref.Name, err))
+			continue
+		}
+		if !hasObject(applied.Objects, ref) {
+			applied.Objects = append(applied.Objects, ref)
+		}
+	}
+
+	var stale, kept []autoscaling.CrossVersionObjectReference
+	for _, ref := range applied.Objects {
+		if wanted[ref] {
+			kept = append(kept, ref)
+		} else {
+			stale = append(stale, ref)
+		}
+	}
+	applied.Objects = append(kept, a.deleteManifests(p, stale, &errs)...)
+	return utilerrors.NewAggregate(errs)
+}
+
+// createManifest creates obj for the window w of p, unless the window
+// created it already. An object of the same name created by someone else is
+// left alone.
+func (a *TimebasedController) createManifest(p *api.Policy, w *api.ScalingWindow, obj *unstructured.Unstructured) error {
+	ref := object.Ref(obj)
+	namespaced, err := a.objects.Namespaced(ref)
+	if err != nil {
+		return err
+	}
+	if namespaced {
+		if ns := obj.GetNamespace(); ns != "" && ns != p.Namespace {
+			return fmt.Errorf("manifests can only create objects in namespace %s", p.Namespace)
+		}
+		obj.SetNamespace(p.Namespace)
+	}
+
+	existing, err := a.objects.Get(p.Namespace, ref)
+	switch {
+	case err == nil:
+		l := existing.GetLabels()
+		if l[policyLabel] != p.Name || l[policyNamespaceLabel] != p.Namespace || l[windowLabel] != w.Name {
+			return fmt.Errorf("exists already and was not created by the window")
+		}
+		return nil
+	case !errors.IsNotFound(err):
+		return err
+	}
+
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[policyLabel], labels[policyNamespaceLabel], labels[windowLabel] = p.Name, p.Namespace, w.Name
+	obj.SetLabels(labels)
+	if owner := manifestOwner(p, namespaced); owner != nil {
+		obj.SetOwnerReferences(append(obj.GetOwnerReferences(), *owner))
+	}
+	glog.V(2).Infof("window %s of policy %s/%s creates %s %s", w.Name, p.Namespace, p.Name, ref.Kind, ref.Name)
+	_, err = a.objects.Create(p.Namespace, obj)
+	return err
+}
+
+// deleteManifests deletes the objects refs point at on behalf of p, and
+// returns the ones that could not be deleted, adding why to errs.
+func (a *TimebasedController) deleteManifests(p *api.Policy, refs []autoscaling.CrossVersionObjectReference, errs *[]error) []autoscaling.CrossVersionObjectReference {
+	var left []autoscaling.CrossVersionObjectReference
+	for _, ref := range refs {
+		glog.V(2).Infof("policy %s/%s deletes %s %s", p.Namespace, p.Name, ref.Kind, ref.Name)
+		if err := a.objects.Delete(p.Namespace, ref); err != nil && !errors.IsNotFound(err) {
+			*errs = append(*errs, fmt.Errorf("%s %s: %v", ref.Kind, ref.Name, err))
+			left = append(left, ref)
+		}
+	}
+	return left
+}
+
+// manifestOwner returns the owner reference that makes the garbage collector
+// delete an object created from the manifests of p along with p, or nil if
+// there is none. A Policy can only own namespaced objects; in a namespace a
+// cluster policy applies to, p stands for the cluster policy that controls
+// it, which can own both.
+func manifestOwner(p *api.Policy, namespaced bool) *metav1.OwnerReference {
+	if p.UID == "" {
+		if ref := metav1.GetControllerOf(p); ref != nil {
+			return &metav1.OwnerReference{APIVersion: ref.APIVersion, Kind: ref.Kind, Name: ref.Name, UID: ref.UID}
+		}
+		return nil
+	}
+	if !namespaced {
+		return nil
+	}
+	return &metav1.OwnerReference{APIVersion: api.SchemeGroupVersion.String(), Kind: "Policy", Name: p.Name, UID: p.UID}
+}
+
+// hasObject reports whether refs holds ref.
+func hasObject(refs []autoscaling.CrossVersionObjectReference, ref autoscaling.CrossVersionObjectReference) bool {
+	for _, r := range refs {
+		if r == ref {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,318 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+// applyNodeMaintenance takes the nodes of the open maintenance windows of
+// the policy of e into maintenance in turn, and restores the ones of windows
+// that have closed or are gone from the spec. Maintenance rules start a run
+// over their nodes when they fire, which lasts until every node has had its
+// turn. Like manifests, maintenance belongs to the policy rather than to its
+// targets.
+func (a *TimebasedController) applyNodeMaintenance(e *evaluation) {
+	p := e.policy
+	open := sets.NewString()
+	for _, ws := range e.status.Windows {
+		if w := window(p, ws.Name); ws.Active && w != nil && w.Action == api.NodeMaintenanceWindow {
+			open.Insert(ws.Name)
+		}
+	}
+
+	var errs []error
+	now := metav1.Now()
+	for i := range p.Spec.Windows {
+		w := &p.Spec.Windows[i]
+		if !open.Has(w.Name) {
+			continue
+		}
+		st := e.status.NodeMaintenanceStatus(w.Name)
+		if st == nil {
+			e.status.NodeMaintenance = append(e.status.NodeMaintenance, api.NodeMaintenanceStatus{Window: w.Name})
+			st = &e.status.NodeMaintenance[len(e.status.NodeMaintenance)-1]
+		}
+		if err := a.maintainNodes(maintenanceOwner(st), w.NodeMaintenance, st, now); err != nil {
+			errs = append(errs, fmt.Errorf("window %s: %v", w.Name, err))
+		}
+	}
+
+	running := sets.NewString()
+	for i := range p.Spec.Rules {
+		r := &p.Spec.Rules[i]
+		if r.Action != api.MaintainNodes {
+			continue
+		}
+		st := e.status.NodeMaintenanceRun(r.Name)
+		if t, ok := e.unmet[r.Name]; ok {
+			if rs := e.status.RuleStatus(r.Name); rs != nil {
+				rs.LastScheduleTime = &metav1.Time{Time: t}
+			}
+			if st == nil {
+				glog.V(2).Infof("rule %s of policy %s/%s starts a node maintenance run", r.Name, p.Namespace, p.Name)
+				e.status.NodeMaintenance = append(e.status.NodeMaintenance, api.NodeMaintenanceStatus{Rule: r.Name})
+				st = &e.status.NodeMaintenance[len(e.status.NodeMaintenance)-1]
+			} else {
+				glog.V(2).Infof("rule %s of policy %s/%s fired while its last node maintenance run goes on", r.Name, p.Namespace, p.Name)
+			}
+		}
+		if st == nil {
+			continue
+		}
+		if err := a.maintainNodes(maintenanceOwner(st), r.NodeMaintenance, st, now); err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %v", r.Name, err))
+		}
+		if !maintenanceDone(st) {
+			running.Insert(r.Name)
+		}
+	}
+
+	var kept []api.NodeMaintenanceStatus
+	for _, st := range e.status.NodeMaintenance {
+		if st.Rule == "" && open.Has(st.Window) || st.Rule != "" && running.Has(st.Rule) {
+			kept = append(kept, st)
+			continue
+		}
+		var left []api.MaintainedNode
+		for _, n := range st.Nodes {
+			if n.Phase != api.NodeInMaintenance {
+				continue
+			}
+			glog.V(2).Infof("%s of policy %s/%s is over, restoring node %s", maintenanceOwner(&st), p.Namespace, p.Name, n.Name)
+			if _, err := a.restoreNode(&n); err != nil {
+				errs = append(errs, fmt.Errorf("%s: node %s: %v", maintenanceOwner(&st), n.Name, err))
+				left = append(left, n)
+			}
+		}
+		if len(left) > 0 {
+			st.Nodes = left
+			kept = append(kept, st)
+		}
+	}
+	e.status.NodeMaintenance = kept
+
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		glog.Errorf("failed to maintain the nodes of policy %s/%s: %v", p.Namespace, p.Name, err)
+		e.err = err
+	}
+}
+
+// maintenanceOwner names the window or rule st belongs to.
+func maintenanceOwner(st *api.NodeMaintenanceStatus) string {
+	if st.Rule != "" {
+		return "rule " + st.Rule
+	}
+	return "window " + st.Window
+}
+
+// maintenanceDone reports whether every node st records has had its turn.
+func maintenanceDone(st *api.NodeMaintenanceStatus) bool {
+	for _, n := range st.Nodes {
+		if n.Phase != api.NodeDone {
+			return false
+		}
+	}
+	return true
+}
+
+// maintainNodes moves the nodes m selects along for owner, an open
+// maintenance window or a running maintenance rule, recording their state in
+// st. Nodes are taken in order of their names, as
+// long as no more than the allowed number of selected nodes is unavailable.
+// With a node duration, nodes whose time is up are restored first to make
+// room for the next ones.
+func (a *TimebasedController) maintainNodes(owner string, m *api.NodeMaintenance, st *api.NodeMaintenanceStatus, now metav1.Time) error {
+	if m == nil {
+		return fmt.Errorf("no nodes are selected")
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&m.Selector)
+	if err != nil {
+		return err
+	}
+	nl, err := a.cfg.Client.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+	selected := map[string]*corev1.Node{}
+	unavailable := 0
+	for i := range nl.Items {
+		selected[nl.Items[i].Name] = &nl.Items[i]
+		if !nodeAvailable(&nl.Items[i]) {
+			unavailable++
+		}
+	}
+	maxUnavailable := 1
+	if m.MaxUnavailable != nil {
+		if maxUnavailable, err = intstr.GetValueFromIntOrPercent(m.MaxUnavailable, len(nl.Items), false); err != nil {
+			return err
+		}
+		if maxUnavailable < 1 {
+			maxUnavailable = 1
+		}
+	}
+
+	// Nodes that are gone or no longer selected are dropped, the ones
+	// in maintenance are restored first.
+	var errs []error
+	var nodes []api.MaintainedNode
+	known := sets.NewString()
+	for _, n := range st.Nodes {
+		known.Insert(n.Name)
+		if selected[n.Name] == nil && n.Phase == api.NodeInMaintenance {
+			if _, err := a.restoreNode(&n); err != nil {
+				errs = append(errs, fmt.Errorf("node %s: %v", n.Name, err))
+				nodes = append(nodes, n)
+			}
+			continue
+		}
+		if selected[n.Name] != nil {
+			nodes = append(nodes, n)
+		}
+	}
+	for name := range selected {
+		if !known.Has(name) {
+			nodes = append(nodes, api.MaintainedNode{Name: name, Phase: api.NodePending, LastTransitionTime: &now})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	st.Nodes = nodes
+
+	for i := range st.Nodes {
+		n := &st.Nodes[i]
+		if n.Phase != api.NodeInMaintenance || selected[n.Name] == nil {
+			continue
+		}
+		if m.NodeDuration == nil || n.LastTransitionTime == nil || now.Sub(n.LastTransitionTime.Time) < m.NodeDuration.Duration {
+			// Level triggered: a node uncordoned by someone else during its
+			// maintenance is cordoned again.
+			if err := a.enterMaintenance(n, m.Taints); err != nil {
+				errs = append(errs, fmt.Errorf("node %s: %v", n.Name, err))
+			}
+			continue
+		}
+		glog.V(2).Infof("maintenance of node %s in %s is over", n.Name, owner)
+		node, err := a.restoreNode(n)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("node %s: %v", n.Name, err))
+			continue
+		}
+		n.Phase, n.LastTransitionTime = api.NodeDone, &now
+		// A node that does not come back still counts against the limit.
+		if node == nil || nodeAvailable(node) {
+			unavailable--
+		}
+	}
+
+	for i := range st.Nodes {
+		n := &st.Nodes[i]
+		if n.Phase != api.NodePending {
+			continue
+		}
+		if unavailable >= maxUnavailable {
+			glog.V(4).Infof("%d of the nodes of %s are unavailable, node %s waits", unavailable, owner, n.Name)
+			break
+		}
+		wasAvailable := nodeAvailable(selected[n.Name])
+		n.Unschedulable, n.Taints = selected[n.Name].Spec.Unschedulable, nil
+		glog.V(2).Infof("%s takes node %s into maintenance", owner, n.Name)
+		if err := a.enterMaintenance(n, m.Taints); err != nil {
+			errs = append(errs, fmt.Errorf("node %s: %v", n.Name, err))
+			continue
+		}
+		n.Phase, n.LastTransitionTime = api.NodeInMaintenance, &now
+		if wasAvailable {
+			unavailable++
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// enterMaintenance cordons the node n and adds taints to it, recording in n
+// the taints it did not have.
+func (a *TimebasedController) enterMaintenance(n *api.MaintainedNode, taints []corev1.Taint) error {
+	node, err := a.cfg.Client.CoreV1().Nodes().Get(n.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	changed := !node.Spec.Unschedulable
+	node.Spec.Unschedulable = true
+	for _, t := range taints {
+		if findTaint(node.Spec.Taints, t) >= 0 {
+			continue
+		}
+		node.Spec.Taints = append(node.Spec.Taints, t)
+		if findTaint(n.Taints, t) < 0 {
+			n.Taints = append(n.Taints, t)
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	_, err = a.cfg.Client.CoreV1().Nodes().Update(node)
+	return err
+}
+
+// restoreNode removes the taints recorded in n from the node and uncordons
+// it, unless it was cordoned before its maintenance, and returns the node as
+// restored. A node that is gone has nothing to restore, nil is returned for
+// it.
+func (a *TimebasedController) restoreNode(n *api.MaintainedNode) (*corev1.Node, error) {
+	node, err := a.cfg.Client.CoreV1().Nodes().Get(n.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	if !n.Unschedulable && node.Spec.Unschedulable {
+		node.Spec.Unschedulable, changed = false, true
+	}
+	for _, t := range n.Taints {
+		if i := findTaint(node.Spec.Taints, t); i >= 0 {
+			node.Spec.Taints = append(node.Spec.Taints[:i], node.Spec.Taints[i+1:]...)
+			changed = true
+		}
+	}
+	if !changed {
+		return node, nil
+	}
+	glog.V(2).Infof("node %s is restored after its maintenance", n.Name)
+	return a.cfg.Client.CoreV1().Nodes().Update(node)
+}
+
+// findTaint returns the index of the taint in taints with the key and effect
+// of t, or -1 if there is none.
+func findTaint(taints []corev1.Taint, t corev1.Taint) int {
+	for i := range taints {
+		if taints[i].Key == t.Key && taints[i].Effect == t.Effect {
+			return i
+		}
+	}
+	return -1
+}
+
+// nodeAvailable reports whether node can run new pods: it is schedulable
+// and ready.
+func nodeAvailable(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
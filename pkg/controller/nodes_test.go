@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+// fakeNodes serves the nodes of the core API from memory, for the node
+// maintenance to run against a real client.
+type fakeNodes struct {
+	mu    sync.Mutex
+	nodes map[string]*corev1.Node
+}
+
+func (f *fakeNodes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !strings.HasPrefix(r.URL.Path, "/api/v1/nodes") {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/v1/nodes"), "/")
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		list := &corev1.NodeList{TypeMeta: metav1.TypeMeta{Kind: "NodeList", APIVersion: "v1"}}
+		for _, n := range f.nodes {
+			if selector.Matches(labels.Set(n.Labels)) {
+				list.Items = append(list.Items, *n)
+			}
+		}
+		sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Name < list.Items[j].Name })
+		writeJSON(w, http.StatusOK, list)
+	case f.nodes[name] == nil:
+		writeJSON(w, http.StatusNotFound, &metav1.Status{
+			TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   metav1.StatusFailure,
+			Reason:   metav1.StatusReasonNotFound,
+			Code:     http.StatusNotFound,
+		})
+	case r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, f.nodes[name])
+	case r.Method == http.MethodPut:
+		n := &corev1.Node{}
+		if err := json.NewDecoder(r.Body).Decode(n); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n.Kind, n.APIVersion = "Node", "v1"
+		f.nodes[name] = n
+		writeJSON(w, http.StatusOK, n)
+	default:
+		http.Error(w, "unexpected request", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(obj)
+}
+
+// testNode returns a node of the maintained pool, or of no pool when pool is
+// false.
+func testNode(name string, pool, ready, unschedulable bool) *corev1.Node {
+	n := &corev1.Node{
+		TypeMeta:   metav1.TypeMeta{Kind: "Node", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+		Spec:       corev1.NodeSpec{Unschedulable: unschedulable},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionFalse}},
+		},
+	}
+	if pool {
+		n.Labels["pool"] = "a"
+	}
+	if ready {
+		n.Status.Conditions[0].Status = corev1.ConditionTrue
+	}
+	return n
+}
+
+func TestMaintainNodes(t *testing.T) {
+	now := metav1.Now()
+	hourAgo := metav1.NewTime(now.Add(-time.Hour))
+	taint := corev1.Taint{Key: "maintenance", Effect: corev1.TaintEffectNoSchedule}
+	tests := []struct {
+		name           string
+		nodes          []*corev1.Node
+		maxUnavailable *intstr.IntOrString
+		status         []api.MaintainedNode
+		// want is the phase of every node in the status, unschedulable the
+		// nodes that are cordoned afterwards.
+		want          map[string]api.NodePhase
+		unschedulable []string
+	}{
+		{
+			name:          "nodes are taken in turn",
+			nodes:         []*corev1.Node{testNode("n1", true, true, false), testNode("n2", true, true, false), testNode("n3", true, true, false)},
+			want:          map[string]api.NodePhase{"n1": api.NodeInMaintenance, "n2": api.NodePending, "n3": api.NodePending},
+			unschedulable: []string{"n1"},
+		},
+		{
+			name:           "a percentage of the selected nodes",
+			nodes:          []*corev1.Node{testNode("n1", true, true, false), testNode("n2", true, true, false), testNode("n3", true, true, false), testNode("n4", true, true, false)},
+			maxUnavailable: &intstr.IntOrString{Type: intstr.String, StrVal: "50%"},
+			want:           map[string]api.NodePhase{"n1": api.NodeInMaintenance, "n2": api.NodeInMaintenance, "n3": api.NodePending, "n4": api.NodePending},
+			unschedulable:  []string{"n1", "n2"},
+		},
+		{
+			name:  "unavailable nodes count against the limit",
+			nodes: []*corev1.Node{testNode("n1", true, true, false), testNode("n2", true, false, false)},
+			want:  map[string]api.NodePhase{"n1": api.NodePending, "n2": api.NodePending},
+		},
+		{
+			name:  "a node whose time is up makes room for the next",
+			nodes: []*corev1.Node{testNode("n1", true, true, true), testNode("n2", true, true, false)},
+			status: []api.MaintainedNode{
+				{Name: "n1", Phase: api.NodeInMaintenance, LastTransitionTime: &hourAgo, Taints: []corev1.Taint{taint}},
+				{Name: "n2", Phase: api.NodePending, LastTransitionTime: &hourAgo},
+			},
+			want:          map[string]api.NodePhase{"n1": api.NodeDone, "n2": api.NodeInMaintenance},
+			unschedulable: []string{"n2"},
+		},
+		{
+			name:  "a restored node that is not ready keeps its slot",
+			nodes: []*corev1.Node{testNode("n1", true, false, true), testNode("n2", true, true, false)},
+			status: []api.MaintainedNode{
+				{Name: "n1", Phase: api.NodeInMaintenance, LastTransitionTime: &hourAgo},
+				{Name: "n2", Phase: api.NodePending, LastTransitionTime: &hourAgo},
+			},
+			want: map[string]api.NodePhase{"n1": api.NodeDone, "n2": api.NodePending},
+		},
+		{
+			name:  "a node cordoned before its maintenance stays cordoned",
+			nodes: []*corev1.Node{testNode("n1", true, true, true), testNode("n2", true, true, false)},
+			status: []api.MaintainedNode{
+				{Name: "n1", Phase: api.NodeInMaintenance, LastTransitionTime: &hourAgo, Unschedulable: true},
+				{Name: "n2", Phase: api.NodePending, LastTransitionTime: &hourAgo},
+			},
+			want:          map[string]api.NodePhase{"n1": api.NodeDone, "n2": api.NodePending},
+			unschedulable: []string{"n1"},
+		},
+		{
+			name:  "a node no longer selected is restored and dropped",
+			nodes: []*corev1.Node{testNode("n1", true, true, false), testNode("n9", false, true, true)},
+			status: []api.MaintainedNode{
+				{Name: "n9", Phase: api.NodeInMaintenance, LastTransitionTime: &now},
+			},
+			want:          map[string]api.NodePhase{"n1": api.NodeInMaintenance},
+			unschedulable: []string{"n1"},
+		},
+		{
+			name:  "a node that is gone is dropped",
+			nodes: []*corev1.Node{testNode("n1", true, true, false)},
+			status: []api.MaintainedNode{
+				{Name: "n0", Phase: api.NodeInMaintenance, LastTransitionTime: &now},
+			},
+			want:          map[string]api.NodePhase{"n1": api.NodeInMaintenance},
+			unschedulable: []string{"n1"},
+		},
+	}
+	for _, tt := range tests {
+		fake := &fakeNodes{nodes: map[string]*corev1.Node{}}
+		for _, n := range tt.nodes {
+			fake.nodes[n.Name] = n
+		}
+		srv := httptest.NewServer(fake)
+		client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := &TimebasedController{cfg: &Configuration{Client: client}}
+		m := &api.NodeMaintenance{
+			Selector:       metav1.LabelSelector{MatchLabels: map[string]string{"pool": "a"}},
+			Taints:         []corev1.Taint{taint},
+			MaxUnavailable: tt.maxUnavailable,
+			NodeDuration:   &metav1.Duration{Duration: 30 * time.Minute},
+		}
+		st := &api.NodeMaintenanceStatus{Rule: "patching", Nodes: tt.status}
+		err = a.maintainNodes("rule patching", m, st, now)
+		srv.Close()
+		if err != nil {
+			t.Errorf("%s: maintainNodes() error = %v", tt.name, err)
+			continue
+		}
+
+		got := map[string]api.NodePhase{}
+		for _, n := range st.Nodes {
+			got[n.Name] = n.Phase
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: phases = %v, want %v", tt.name, got, tt.want)
+		}
+		for name, phase := range tt.want {
+			if got[name] != phase {
+				t.Errorf("%s: phase of %s = %q, want %q", tt.name, name, got[name], phase)
+			}
+		}
+		var unschedulable []string
+		for name, n := range fake.nodes {
+			if n.Spec.Unschedulable {
+				unschedulable = append(unschedulable, name)
+			}
+			if has := findTaint(n.Spec.Taints, taint) >= 0; has != (got[name] == api.NodeInMaintenance) {
+				t.Errorf("%s: node %s has the maintenance taint: %v, in phase %q", tt.name, name, has, got[name])
+			}
+		}
+		sort.Strings(unschedulable)
+		if strings.Join(unschedulable, ",") != strings.Join(tt.unschedulable, ",") {
+			t.Errorf("%s: cordoned nodes = %v, want %v", tt.name, unschedulable, tt.unschedulable)
+		}
+	}
+}
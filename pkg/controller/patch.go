@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+// applyPatch applies the patch of the open window w to the target of e, once
+// for every time the window opens. The patch, its revert patch and the
+// outcome are recorded in applied; a patch that failed is tried again on the
+// next pass.
+func (a *TimebasedController) applyPatch(e *evaluation, w *api.ScalingWindow, applied *api.AppliedWindow, reference string) error {
+	if w.Patch == nil {
+		return fmt.Errorf("no patch is set")
+	}
+	if applied.Patch != nil && applied.Patch.Error == "" {
+		// Applied already, only a change of the revert patch is taken.
+		applied.Patch.Revert = w.Patch.Revert
+		return nil
+	}
+
+	now := metav1.Now()
+	applied.Patch = &api.AppliedPatch{WindowPatch: *w.Patch, Time: &now}
+	glog.V(2).Infof("window %s of policy %s/%s patches %s", w.Name, e.policy.Namespace, e.policy.Name, reference)
+	resourceVersion, err := a.patch(e, w.Patch.Type, w.Patch.Apply)
+	if err != nil {
+		applied.Patch.Error = err.Error()
+		return err
+	}
+	applied.Patch.ResourceVersion = resourceVersion
+	return nil
+}
+
+// revertPatch applies the revert patch recorded in applied to the target of
+// e. Nothing is reverted when there is no revert patch or the patch was not
+// applied, nor when the target is gone.
+func (a *TimebasedController) revertPatch(e *evaluation, applied *api.AppliedWindow, reference string) error {
+	p := applied.Patch
+	if p.Revert == "" || p.Error != "" {
+		return nil
+	}
+	glog.V(2).Infof("window %s of policy %s/%s reverts its patch of %s", applied.Name, e.policy.Namespace, e.policy.Name, reference)
+	if _, err := a.patch(e, p.Type, p.Revert); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// patch applies patch, written in JSON or YAML, of type pt to the target of
+// e and returns the resource version of the result.
+func (a *TimebasedController) patch(e *evaluation, pt api.PatchType, patch string) (string, error) {
+	data, err := yaml.YAMLToJSON([]byte(patch))
+	if err != nil {
+		return "", fmt.Errorf("failed to read the patch: %v", err)
+	}
+	patchType := types.MergePatchType
+	switch pt {
+	case "", api.MergePatch:
+	case api.JSONPatch:
+		patchType = types.JSONPatchType
+	default:
+		return "", fmt.Errorf("unknown patch type %q", pt)
+	}
+	obj, err := a.objects.Patch(e.policy.Namespace, *e.target, patchType, data)
+	if err != nil {
+		return "", err
+	}
+	return obj.GetResourceVersion(), nil
+}
@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+// applyQuotas sets the limits of the open quota windows of the policy of e
+// on their ResourceQuotas, and restores the ones of windows that have closed
+// or are gone from the spec. Like manifests, quotas belong to the policy
+// rather than to its targets.
+//
+// A limit is never lowered below what the namespace already uses, as that
+// would leave it over quota: the reduction is deferred, and reported in the
+// status, until enough is released. This holds for restoring too, when the
+// window raised a limit and the namespace has grown into it.
+func (a *TimebasedController) applyQuotas(e *evaluation) {
+	p := e.policy
+	open := sets.NewString()
+	for _, ws := range e.status.Windows {
+		if w := window(p, ws.Name); ws.Active && w != nil && w.Action == api.QuotaWindow {
+			open.Insert(ws.Name)
+		}
+	}
+
+	var errs []error
+	for i := range p.Spec.Windows {
+		w := &p.Spec.Windows[i]
+		if !open.Has(w.Name) {
+			continue
+		}
+		applied := e.status.AppliedQuotas(w.Name)
+		if applied == nil {
+			e.status.Quotas = append(e.status.Quotas, api.AppliedQuotas{Window: w.Name})
+			applied = &e.status.Quotas[len(e.status.Quotas)-1]
+		}
+		for _, limits := range w.Quotas {
+			if err := a.setQuota(e, w.Name, limits, applied); err != nil {
+				errs = append(errs, fmt.Errorf("window %s: ResourceQuota %s: %v", w.Name, limits.Name, err))
+			}
+		}
+	}
+
+	var kept []api.AppliedQuotas
+	for _, applied := range e.status.Quotas {
+		if open.Has(applied.Window) {
+			kept = append(kept, applied)
+			continue
+		}
+		var left []api.AppliedQuota
+		for _, q := range applied.Quotas {
+			done, err := a.restoreQuota(e, applied.Window, &q)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("window %s: ResourceQuota %s: %v", applied.Window, q.Name, err))
+			}
+			if !done {
+				left = append(left, q)
+			}
+		}
+		if len(left) > 0 {
+			applied.Quotas = left
+			kept = append(kept, applied)
+		}
+	}
+	e.status.Quotas = kept
+
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		glog.Errorf("failed to apply the quotas of policy %s/%s: %v", p.Namespace, p.Name, err)
+		e.err = err
+	}
+}
+
+// setQuota gives the ResourceQuota named by limits the limits of the open
+// window, recording in applied the limits it had before the window first
+// changed them.
+func (a *TimebasedController) setQuota(e *evaluation, window string, limits api.QuotaLimits, applied *api.AppliedQuotas) error {
+	quotas := a.cfg.Client.CoreV1().ResourceQuotas(e.policy.Namespace)
+	quota, err := quotas.Get(limits.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	var q *api.AppliedQuota
+	for i := range applied.Quotas {
+		if applied.Quotas[i].Name == limits.Name {
+			q = &applied.Quotas[i]
+		}
+	}
+	if q == nil {
+		applied.Quotas = append(applied.Quotas, api.AppliedQuota{Name: limits.Name})
+		q = &applied.Quotas[len(applied.Quotas)-1]
+	}
+	if quota.Spec.Hard == nil {
+		quota.Spec.Hard = corev1.ResourceList{}
+	}
+
+	changed := false
+	var deferred []string
+	for _, name := range resourceNames(limits.Hard) {
+		want := limits.Hard[name]
+		current, limited := quota.Spec.Hard[name]
+		if _, recorded := q.Hard[name]; !recorded && !hasResourceName(q.Unset, name) {
+			if limited {
+				if q.Hard == nil {
+					q.Hard = corev1.ResourceList{}
+				}
+				q.Hard[name] = current.DeepCopy()
+			} else {
+				q.Unset = append(q.Unset, name)
+			}
+		}
+		if limited && current.Cmp(want) == 0 {
+			continue
+		}
+		if reason := overUsage(quota, name, want, current, limited); reason != "" {
+			deferred = append(deferred, reason)
+			continue
+		}
+		quota.Spec.Hard[name] = want.DeepCopy()
+		changed = true
+	}
+	q.Deferred = strings.Join(deferred, ", ")
+	if q.Deferred != "" {
+		glog.V(2).Infof("window %s of policy %s/%s defers lowering ResourceQuota %s: %s", window, e.policy.Namespace, e.policy.Name, limits.Name, q.Deferred)
+	}
+	if !changed {
+		return nil
+	}
+	glog.V(2).Infof("window %s of policy %s/%s sets the limits of ResourceQuota %s", window, e.policy.Namespace, e.policy.Name, limits.Name)
+	_, err = quotas.Update(quota)
+	return err
+}
+
+// restoreQuota puts back the limits the ResourceQuota recorded in q had
+// before the window opened. It reports whether it is done, which it is not
+// while a limit is deferred because the namespace uses more than it allows.
+// A quota that is gone has nothing to restore.
+func (a *TimebasedController) restoreQuota(e *evaluation, window string, q *api.AppliedQuota) (bool, error) {
+	quotas := a.cfg.Client.CoreV1().ResourceQuotas(e.policy.Namespace)
+	quota, err := quotas.Get(q.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if quota.Spec.Hard == nil {
+		quota.Spec.Hard = corev1.ResourceList{}
+	}
+
+	changed := false
+	var deferred []string
+	pending := corev1.ResourceList{}
+	for _, name := range resourceNames(q.Hard) {
+		want := q.Hard[name]
+		current, limited := quota.Spec.Hard[name]
+		if limited && current.Cmp(want) == 0 {
+			continue
+		}
+		if reason := overUsage(quota, name, want, current, limited); reason != "" {
+			deferred = append(deferred, reason)
+			pending[name] = want.DeepCopy()
+			continue
+		}
+		quota.Spec.Hard[name] = want.DeepCopy()
+		changed = true
+	}
+	for _, name := range q.Unset {
+		if _, limited := quota.Spec.Hard[name]; limited {
+			delete(quota.Spec.Hard, name)
+			changed = true
+		}
+	}
+
+	if changed {
+		glog.V(2).Infof("window %s of policy %s/%s has closed, restoring the limits of ResourceQuota %s", window, e.policy.Namespace, e.policy.Name, q.Name)
+		if _, err := quotas.Update(quota); err != nil {
+			return false, err
+		}
+	}
+	q.Unset = nil
+	q.Hard = pending
+	q.Deferred = strings.Join(deferred, ", ")
+	if q.Deferred != "" {
+		glog.V(2).Infof("window %s of policy %s/%s defers restoring ResourceQuota %s: %s", window, e.policy.Namespace, e.policy.Name, q.Name, q.Deferred)
+		return false, nil
+	}
+	return true, nil
+}
+
+// overUsage tells why the limit of quota on the resource name cannot be
+// lowered to want from current, or returns "" if it can. Raising a limit
+// always can; limiting a resource that was not limited before is held back
+// like lowering a limit.
+func overUsage(quota *corev1.ResourceQuota, name corev1.ResourceName, want, current resource.Quantity, limited bool) string {
+	if limited && want.Cmp(current) >= 0 {
+		return ""
+	}
+	used, ok := quota.Status.Used[name]
+	if !ok || used.Cmp(want) <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s used %s is above %s", name, used.String(), want.String())
+}
+
+// resourceNames returns the names of list in order, so that the status does
+// not change from one pass to the next.
+func resourceNames(list corev1.ResourceList) []corev1.ResourceName {
+	names := make([]corev1.ResourceName, 0, len(list))
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+func hasResourceName(names []corev1.ResourceName, name corev1.ResourceName) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
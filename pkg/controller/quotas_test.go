@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestOverUsage(t *testing.T) {
+	quota := &corev1.ResourceQuota{
+		Status: corev1.ResourceQuotaStatus{
+			Used: corev1.ResourceList{
+				corev1.ResourceCPU:  resource.MustParse("6"),
+				corev1.ResourcePods: resource.MustParse("10"),
+			},
+		},
+	}
+	tests := []struct {
+		name          string
+		resource      corev1.ResourceName
+		want, current string
+		limited       bool
+		wantReason    string
+	}{
+		{"raising always can", corev1.ResourceCPU, "12", "8", true, ""},
+		{"unchanged", corev1.ResourceCPU, "8", "8", true, ""},
+		{"lowering above usage", corev1.ResourceCPU, "7", "8", true, ""},
+		{"lowering to usage", corev1.ResourceCPU, "6", "8", true, ""},
+		{"lowering below usage", corev1.ResourceCPU, "4", "8", true, "cpu used 6 is above 4"},
+		{"limiting below usage", corev1.ResourcePods, "5", "0", false, "pods used 10 is above 5"},
+		{"limiting above usage", corev1.ResourcePods, "20", "0", false, ""},
+		{"usage not reported", corev1.ResourceMemory, "1Gi", "4Gi", true, ""},
+	}
+	for _, tt := range tests {
+		got := overUsage(quota, tt.resource, resource.MustParse(tt.want), resource.MustParse(tt.current), tt.limited)
+		if got != tt.wantReason {
+			t.Errorf("%s: overUsage(%s, %s, %s) = %q, want %q", tt.name, tt.resource, tt.want, tt.current, got, tt.wantReason)
+		}
+	}
+}
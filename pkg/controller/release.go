@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+// finalizer keeps a deleted Policy or ClusterPolicy with windows, or a deleted
+// Hibernation, until the changes it made are undone, which takes the records
+// of them in its status.
+const finalizer = "icp.ibm.com/timebase"
+
+// releasedWindow names the window that stands for the scale windows of a
+// released policy: closed for good, it restores the scale the target had
+// before they opened.
+const releasedWindow = "released"
+
+// needsFinalizer reports whether p has windows or maintenance rules, or
+// records changes of windows, that have to be undone when it is deleted.
+func needsFinalizer(p *api.Policy) bool {
+	if len(p.Spec.Windows) > 0 || hasAppliedWindows(&p.Status) {
+		return true
+	}
+	for i := range p.Spec.Rules {
+		if p.Spec.Rules[i].Action == api.MaintainNodes {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterPolicyNeedsFinalizer reports whether cp has windows, or records
+// changes of windows in any namespace, that have to be undone when it is
+// deleted.
+func clusterPolicyNeedsFinalizer(cp *api.ClusterPolicy) bool {
+	if len(cp.Spec.Windows) > 0 {
+		return true
+	}
+	for i := range cp.Status.Namespaces {
+		if cp.Status.Namespaces[i].Applied {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFinalizer(meta *metav1.ObjectMeta) bool {
+	for _, f := range meta.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutFinalizer(finalizers []string) []string {
+	var kept []string
+	for _, f := range finalizers {
+		if f != finalizer {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// addPolicyFinalizer adds the finalizer to p and returns the updated policy.
+func (a *TimebasedController) addPolicyFinalizer(p *api.Policy) (*api.Policy, error) {
+	policy := p.DeepCopy()
+	policy.Finalizers = append(policy.Finalizers, finalizer)
+	result, err := a.cfg.PolicyClient.IcpV1beta2().Policies(p.Namespace).Update(policy)
+	if err != nil {
+		return nil, err
+	}
+	return result, a.policyInformer.GetIndexer().Update(result)
+}
+
+// removePolicyFinalizer removes the finalizer from p, retrying a conflicting
+// write against the latest copy, so that the apiserver can delete it.
+func (a *TimebasedController) removePolicyFinalizer(p *api.Policy) error {
+	policy, err := a.policyLister.Policies(p.Namespace).Get(p.Name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	policy = policy.DeepCopy()
+	for i := 0; ; i++ {
+		policy.Finalizers = withoutFinalizer(policy.Finalizers)
+		_, err := a.cfg.PolicyClient.IcpV1beta2().Policies(policy.Namespace).Update(policy)
+		if err == nil || errors.IsNotFound(err) {
+			return nil
+		}
+		if !errors.IsConflict(err) || i >= statusUpdateRetries {
+			return err
+		}
+
+		policy, err = a.cfg.PolicyClient.IcpV1beta2().Policies(p.Namespace).Get(p.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// addClusterPolicyFinalizer adds the finalizer to cp and returns the updated
+// cluster policy.
+func (a *TimebasedController) addClusterPolicyFinalizer(cp *api.ClusterPolicy) (*api.ClusterPolicy, error) {
+	policy := cp.DeepCopy()
+	policy.Finalizers = append(policy.Finalizers, finalizer)
+	result, err := a.cfg.PolicyClient.IcpV1beta2().ClusterPolicies().Update(policy)
+	if err != nil {
+		return nil, err
+	}
+	return result, a.clusterPolicyInformer.GetIndexer().Update(result)
+}
+
+// removeClusterPolicyFinalizer removes the finalizer from cp, retrying a
+// conflicting write against the latest copy, so that the apiserver can
+// delete it.
+func (a *TimebasedController) removeClusterPolicyFinalizer(cp *api.ClusterPolicy) error {
+	policy, err := a.clusterPolicyLister.Get(cp.Name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	policy = policy.DeepCopy()
+	for i := 0; ; i++ {
+		policy.Finalizers = withoutFinalizer(policy.Finalizers)
+		_, err := a.cfg.PolicyClient.IcpV1beta2().ClusterPolicies().Update(policy)
+		if err == nil || errors.IsNotFound(err) {
+			return nil
+		}
+		if !errors.IsConflict(err) || i >= statusUpdateRetries {
+			return err
+		}
+
+		policy, err = a.cfg.PolicyClient.IcpV1beta2().ClusterPolicies().Get(cp.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// addHibernationFinalizer adds the finalizer to h and returns the updated
+// hibernation.
+func (a *TimebasedController) addHibernationFinalizer(h *api.Hibernation) (*api.Hibernation, error) {
+	hibernation := h.DeepCopy()
+	hibernation.Finalizers = append(hibernation.Finalizers, finalizer)
+	result, err := a.cfg.PolicyClient.IcpV1beta2().Hibernations(h.Namespace).Update(hibernation)
+	if err != nil {
+		return nil, err
+	}
+	return result, a.hibernationInformer.GetIndexer().Update(result)
+}
+
+// removeHibernationFinalizer removes the finalizer from h, retrying a
+// conflicting write against the latest copy, so that the apiserver can
+// delete it.
+func (a *TimebasedController) removeHibernationFinalizer(h *api.Hibernation) error {
+	hibernation, err := a.hibernationLister.Hibernations(h.Namespace).Get(h.Name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	hibernation = hibernation.DeepCopy()
+	for i := 0; ; i++ {
+		hibernation.Finalizers = withoutFinalizer(hibernation.Finalizers)
+		_, err := a.cfg.PolicyClient.IcpV1beta2().Hibernations(hibernation.Namespace).Update(hibernation)
+		if err == nil || errors.IsNotFound(err) {
+			return nil
+		}
+		if !errors.IsConflict(err) || i >= statusUpdateRetries {
+			return err
+		}
+
+		hibernation, err = a.cfg.PolicyClient.IcpV1beta2().Hibernations(h.Namespace).Get(h.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// evaluateRelease evaluates p at now as it is once released: without rules,
+// and with every window closed for good. The changes recorded in its status
+// are then undone like those of windows that closed or were removed from the
+// spec. If windows of p held its targets at a scale, a closed window that
+// restores the scale they had before takes their place, unless the windows of
+// other policies of the target decide its scale.
+func (a *TimebasedController) evaluateRelease(p *api.Policy, now time.Time) ([]*evaluation, error) {
+	r := p.DeepCopy()
+	r.Spec.Rules, r.Spec.Windows = nil, nil
+	if r.Spec.ScaleTargetRef == nil && r.Spec.TargetSelector == nil {
+		return []*evaluation{evaluatePolicy(r, now)}, nil
+	}
+	evals, err := a.evaluateTargets(r, now)
+	if err != nil || !hasScaleWindows(p) {
+		return evals, err
+	}
+	r.Spec.Windows = []api.ScalingWindow{{Name: releasedWindow, Restore: true}}
+	for _, e := range evals {
+		e.window = &r.Spec.Windows[0]
+		e.claim()
+	}
+	return evals, nil
+}
+
+// released reports whether the release evals were computed for is over:
+// nothing recorded in status is left to undo, and the pass did not fail but
+// for targets that are gone.
+func (a *TimebasedController) released(evals []*evaluation, status *api.PolicyStatus) bool {
+	if hasAppliedWindows(status) {
+		return false
+	}
+	for _, e := range evals {
+		if e.err == nil {
+			continue
+		}
+		if e.target == nil {
+			return false
+		}
+		if _, err := a.scales.Get(e.policy.Namespace, *e.target); !errors.IsNotFound(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// finishRelease writes the status of the deleted policy p, computed by evals,
+// and once it is released lets the apiserver delete it.
+func (a *TimebasedController) finishRelease(p *api.Policy, evals []*evaluation) {
+	status := mergeStatus(evals)
+	if !equality.Semantic.DeepEqual(p.Status, status) {
+		if err := a.updatePolicyStatus(p, status); err != nil {
+			glog.Errorf("failed to update status of policy %s/%s: %v", p.Namespace, p.Name, err)
+			return
+		}
+	}
+	if !a.released(evals, &status) {
+		return
+	}
+	glog.V(2).Infof("policy %s/%s has been released, removing its finalizer", p.Namespace, p.Name)
+	if err := a.removePolicyFinalizer(p); err != nil {
+		glog.Errorf("failed to remove the finalizer of policy %s/%s: %v", p.Namespace, p.Name, err)
+	}
+}
@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"github.com/hchenxa/timebase/pkg/object"
+)
+
+// applyResources gives the containers of the target of e the resources the
+// open window w asks for, bounded by the LimitRanges of the namespace. The
+// resources a container had before are recorded in applied the first time
+// the window changes it; when another window of the policy changed it first,
+// the resources recorded by that window are taken over, so that whichever
+// closes last puts back what the container had before either opened.
+func (a *TimebasedController) applyResources(e *evaluation, w *api.ScalingWindow, applied *api.AppliedWindow, reference string) error {
+	namespace := e.policy.Namespace
+	obj, err := a.objects.Get(namespace, *e.target)
+	if err != nil {
+		return err
+	}
+	containers, err := podContainers(obj)
+	if err != nil {
+		return err
+	}
+	ranges, err := a.cfg.Client.CoreV1().LimitRanges(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list LimitRanges: %v", err)
+	}
+
+	changed := false
+	for _, cr := range w.Resources {
+		c := containers[cr.Name]
+		if c == nil {
+			return fmt.Errorf("%s has no container %s", reference, cr.Name)
+		}
+		current, err := containerResources(c)
+		if err != nil {
+			return err
+		}
+		if containerResourcesOf(applied.Resources, cr.Name) == nil {
+			original := originalResources(e.status.AppliedWindows, applied.Name, cr.Name)
+			if original == nil {
+				original = &api.ContainerResources{Name: cr.Name, Resources: current}
+			}
+			applied.Resources = append(applied.Resources, *original.DeepCopy())
+		}
+
+		want := limitResources(ranges.Items, cr.Resources)
+		if equality.Semantic.DeepEqual(current, want) {
+			continue
+		}
+		if !equality.Semantic.DeepEqual(want, cr.Resources) {
+			glog.V(2).Infof("LimitRanges of %s bound the resources window %s asks for container %s", namespace, w.Name, cr.Name)
+		}
+		glog.V(2).Infof("window %s of policy %s/%s sets the resources of container %s of %s", w.Name, namespace, e.policy.Name, cr.Name, reference)
+		if err := setContainerResources(c, want); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	_, err = a.objects.Update(namespace, obj)
+	return err
+}
+
+// restoreResources puts back the resources the containers of the target of
+// e had before the window recorded in applied opened. A target or container
+// that is gone has nothing to restore.
+func (a *TimebasedController) restoreResources(e *evaluation, applied *api.AppliedWindow, reference string) error {
+	namespace := e.policy.Namespace
+	obj, err := a.objects.Get(namespace, *e.target)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	containers, err := podContainers(obj)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, cr := range applied.Resources {
+		c := containers[cr.Name]
+		if c == nil {
+			continue
+		}
+		current, err := containerResources(c)
+		if err != nil {
+			return err
+		}
+		if equality.Semantic.DeepEqual(current, cr.Resources) {
+			continue
+		}
+		glog.V(2).Infof("window %s of policy %s/%s restores the resources of container %s of %s", applied.Name, namespace, e.policy.Name, cr.Name, reference)
+		if err := setContainerResources(c, cr.Resources); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	_, err = a.objects.Update(namespace, obj)
+	return err
+}
+
+// originalResources returns the resources recorded for the named container
+// by an applied window other than the named one, or nil if there are none.
+func originalResources(windows []api.AppliedWindow, window, container string) *api.ContainerResources {
+	for _, w := range windows {
+		if w.Name == window {
+			continue
+		}
+		if cr := containerResourcesOf(w.Resources, container); cr != nil {
+			return cr
+		}
+	}
+	return nil
+}
+
+// containerResourcesOf returns the resources of the named container in
+// resources, or nil if there are none.
+func containerResourcesOf(resources []api.ContainerResources, name string) *api.ContainerResources {
+	for i := range resources {
+		if resources[i].Name == name {
+			return &resources[i]
+		}
+	}
+	return nil
+}
+
+// limitResources bounds r by the container limits of ranges: every request
+// and limit is raised to the minimum and lowered to the maximum, requests
+// are raised until the limit is within the maximum ratio to them, and a
+// request never exceeds its limit.
+func limitResources(ranges []corev1.LimitRange, r corev1.ResourceRequirements) corev1.ResourceRequirements {
+	r = *r.DeepCopy()
+	for _, lr := range ranges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			for name, max := range item.Max {
+				for _, list := range []corev1.ResourceList{r.Requests, r.Limits} {
+					if q, ok := list[name]; ok && q.Cmp(max) > 0 {
+						list[name] = *max.Copy()
+					}
+				}
+			}
+			for name, min := range item.Min {
+				for _, list := range []corev1.ResourceList{r.Requests, r.Limits} {
+					if q, ok := list[name]; ok && q.Cmp(min) < 0 {
+						list[name] = *min.Copy()
+					}
+				}
+			}
+			for name, ratio := range item.MaxLimitRequestRatio {
+				request, hasRequest := r.Requests[name]
+				limit, hasLimit := r.Limits[name]
+				if !hasRequest || !hasLimit || ratio.MilliValue() <= 0 {
+					continue
+				}
+				least := int64(math.Ceil(float64(limit.MilliValue()) * 1000 / float64(ratio.MilliValue())))
+				if request.MilliValue() < least {
+					r.Requests[name] = *resource.NewMilliQuantity(least, request.Format)
+				}
+			}
+		}
+	}
+	for name, limit := range r.Limits {
+		if request, ok := r.Requests[name]; ok && request.Cmp(limit) > 0 {
+			r.Requests[name] = *limit.Copy()
+		}
+	}
+	return r
+}
+
+// podContainers returns the containers of the pod template of obj by name.
+// The pod template of a CronJob is the one of its job template.
+func podContainers(obj *unstructured.Unstructured) (map[string]map[string]interface{}, error) {
+	spec, _ := object.Field(obj.Object, "spec", "jobTemplate", "spec", "template", "spec").(map[string]interface{})
+	if spec == nil {
+		spec, _ = object.Field(obj.Object, "spec", "template", "spec").(map[string]interface{})
+	}
+	if spec == nil {
+		return nil, fmt.Errorf("%s %s has no pod template", obj.GetKind(), obj.GetName())
+	}
+	list, _ := spec["containers"].([]interface{})
+	containers := make(map[string]map[string]interface{}, len(list))
+	for _, item := range list {
+		if c, ok := item.(map[string]interface{}); ok {
+			if name, ok := c["name"].(string); ok {
+				containers[name] = c
+			}
+		}
+	}
+	return containers, nil
+}
+
+// containerResources reads the resources of the container c.
+func containerResources(c map[string]interface{}) (corev1.ResourceRequirements, error) {
+	var r corev1.ResourceRequirements
+	raw, err := json.Marshal(c["resources"])
+	if err != nil {
+		return r, err
+	}
+	if string(raw) == "null" {
+		return r, nil
+	}
+	err = json.Unmarshal(raw, &r)
+	return r, err
+}
+
+// setContainerResources sets the resources of the container c to r, or
+// removes them when r is empty.
+func setContainerResources(c map[string]interface{}, r corev1.ResourceRequirements) error {
+	if len(r.Requests) == 0 && len(r.Limits) == 0 {
+		delete(c, "resources")
+		return nil
+	}
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	var resources map[string]interface{}
+	if err := json.Unmarshal(raw, &resources); err != nil {
+		return err
+	}
+	c["resources"] = resources
+	return nil
+}
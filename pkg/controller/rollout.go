@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"github.com/hchenxa/timebase/pkg/object"
+)
+
+// restartedAtAnnotation is the pod template annotation kubectl rollout
+// restart sets, a change of it rolls the pods out again.
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// defaultRolloutDeadline is how long the rollout of a StatefulSet or
+// DaemonSet may take before it counts as failed, unless the restart rule
+// sets a progress deadline. Deployments have a progress deadline of their
+// own.
+const defaultRolloutDeadline = 10 * time.Minute
+
+// rolloutDeadline returns how long the rollout of obj the rule started may
+// take, or zero when only the progress deadline of the Deployment counts.
+func rolloutDeadline(rule *api.PolicyRule, obj *unstructured.Unstructured) time.Duration {
+	switch {
+	case rule != nil && rule.ProgressDeadline != nil:
+		return rule.ProgressDeadline.Duration
+	case obj.GetKind() == "Deployment":
+		return 0
+	}
+	return defaultRolloutDeadline
+}
+
+// restart rolls the target of e out again on behalf of its due restart rule,
+// by setting the restart annotation of its pod template to the schedule time
+// of the rule. A restart that was made already for the same schedule time
+// changes nothing.
+func (a *TimebasedController) restart(e *evaluation, reference string) error {
+	switch e.target.Kind {
+	case "Deployment", "StatefulSet", "DaemonSet":
+	default:
+		return fmt.Errorf("%s cannot be restarted, only Deployments, StatefulSets and DaemonSets can", reference)
+	}
+
+	now := metav1.Now()
+	e.status.Rollout = &api.RolloutStatus{Rule: e.due.Name, Phase: api.RolloutProgressing, StartTime: &now}
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, restartedAtAnnotation, e.dueTime.UTC().Format(time.RFC3339))
+	glog.V(2).Infof("rule %s of policy %s/%s restarts %s", e.due.Name, e.policy.Namespace, e.policy.Name, reference)
+	obj, err := a.objects.Patch(e.policy.Namespace, *e.target, types.MergePatchType, []byte(patch))
+	if err != nil {
+		e.status.Rollout.Phase, e.status.Rollout.CompletionTime = api.RolloutFailed, &now
+		e.status.Rollout.Message = err.Error()
+		return err
+	}
+	e.status.Rollout.Generation = obj.GetGeneration()
+	return nil
+}
+
+// trackRollout follows the rollout a restart rule of e started until it
+// completes or fails, and records its progress in the status of e.
+func (a *TimebasedController) trackRollout(e *evaluation, reference string) {
+	r := e.status.Rollout
+	if r == nil || r.Phase != api.RolloutProgressing {
+		return
+	}
+	now := metav1.Now()
+	obj, err := a.objects.Get(e.policy.Namespace, *e.target)
+	if errors.IsNotFound(err) {
+		r.Phase, r.CompletionTime, r.Message = api.RolloutFailed, &now, fmt.Sprintf("%s is gone", reference)
+		return
+	}
+	if err != nil {
+		glog.Errorf("failed to follow the rollout of %s: %v", reference, err)
+		return
+	}
+
+	done, failed, message := rolloutProgress(obj, r.Generation)
+	deadline := rolloutDeadline(e.policy.Spec.Rule(r.Rule), obj)
+	r.Message = message
+	switch {
+	case done:
+		glog.V(2).Infof("rollout of %s started by rule %s of policy %s/%s is complete", reference, r.Rule, e.policy.Namespace, e.policy.Name)
+		r.Phase, r.CompletionTime = api.RolloutComplete, &now
+	case failed:
+		glog.Errorf("rollout of %s started by rule %s of policy %s/%s failed: %s", reference, r.Rule, e.policy.Namespace, e.policy.Name, message)
+		r.Phase, r.CompletionTime = api.RolloutFailed, &now
+	case deadline > 0 && r.StartTime != nil && now.Sub(r.StartTime.Time) > deadline:
+		glog.Errorf("rollout of %s started by rule %s of policy %s/%s did not complete within %v", reference, r.Rule, e.policy.Namespace, e.policy.Name, deadline)
+		r.Phase, r.CompletionTime = api.RolloutFailed, &now
+		r.Message = fmt.Sprintf("not complete after %v: %s", deadline, message)
+	}
+}
+
+// rolloutProgress works out, the way kubectl rollout status does, whether
+// the rollout of obj to generation is done or has failed, and how far it has
+// come.
+func rolloutProgress(obj *unstructured.Unstructured, generation int64) (done, failed bool, message string) {
+	if observed := int64Field(obj.Object, "status", "observedGeneration"); observed < generation {
+		return false, false, "waiting for the rollout to be observed"
+	}
+	switch obj.GetKind() {
+	case "Deployment":
+		conditions, _ := object.Field(obj.Object, "status", "conditions").([]interface{})
+		for _, item := range conditions {
+			c, _ := item.(map[string]interface{})
+			if c["type"] == "Progressing" && c["reason"] == "ProgressDeadlineExceeded" {
+				return false, true, fmt.Sprintf("%v", c["message"])
+			}
+		}
+		replicas := int64Field(obj.Object, "spec", "replicas")
+		updated := int64Field(obj.Object, "status", "updatedReplicas")
+		total := int64Field(obj.Object, "status", "replicas")
+		available := int64Field(obj.Object, "status", "availableReplicas")
+		switch {
+		case updated < replicas:
+			return false, false, fmt.Sprintf("%d of %d replicas updated", updated, replicas)
+		case total > updated:
+			return false, false, fmt.Sprintf("%d old replicas pending termination", total-updated)
+		case available < updated:
+			return false, false, fmt.Sprintf("%d of %d updated replicas available", available, updated)
+		}
+		return true, false, fmt.Sprintf("%d replicas updated and available", updated)
+	case "StatefulSet":
+		replicas := int64Field(obj.Object, "spec", "replicas")
+		updated := int64Field(obj.Object, "status", "updatedReplicas")
+		ready := int64Field(obj.Object, "status", "readyReplicas")
+		switch {
+		case updated < replicas:
+			return false, false, fmt.Sprintf("%d of %d replicas updated", updated, replicas)
+		case ready < replicas:
+			return false, false, fmt.Sprintf("%d of %d replicas ready", ready, replicas)
+		case object.Field(obj.Object, "status", "updateRevision") != object.Field(obj.Object, "status", "currentRevision"):
+			return false, false, "waiting for the update revision to become current"
+		}
+		return true, false, fmt.Sprintf("%d replicas updated and ready", replicas)
+	case "DaemonSet":
+		desired := int64Field(obj.Object, "status", "desiredNumberScheduled")
+		updated := int64Field(obj.Object, "status", "updatedNumberScheduled")
+		available := int64Field(obj.Object, "status", "numberAvailable")
+		switch {
+		case updated < desired:
+			return false, false, fmt.Sprintf("%d of %d pods updated", updated, desired)
+		case available < desired:
+			return false, false, fmt.Sprintf("%d of %d updated pods available", available, desired)
+		}
+		return true, false, fmt.Sprintf("%d pods updated and available", desired)
+	}
+	return false, true, fmt.Sprintf("cannot follow the rollout of a %s", obj.GetKind())
+}
+
+// int64Field returns the integer at fields in obj, or zero if there is none.
+func int64Field(obj map[string]interface{}, fields ...string) int64 {
+	switch n := object.Field(obj, fields...).(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// workload builds the object rolloutProgress reads from its JSON.
+func workload(t *testing.T, s string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal([]byte(s), &obj.Object); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func TestRolloutProgress(t *testing.T) {
+	tests := []struct {
+		name         string
+		obj          string
+		done, failed bool
+		message      string
+	}{
+		{
+			name:    "not observed yet",
+			obj:     `{"kind": "Deployment", "spec": {"replicas": 3}, "status": {"observedGeneration": 1}}`,
+			message: "waiting for the rollout to be observed",
+		},
+		{
+			name:    "deployment updating",
+			obj:     `{"kind": "Deployment", "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 4, "updatedReplicas": 1, "availableReplicas": 3}}`,
+			message: "1 of 3 replicas updated",
+		},
+		{
+			name:    "deployment terminating old replicas",
+			obj:     `{"kind": "Deployment", "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 4, "updatedReplicas": 3, "availableReplicas": 3}}`,
+			message: "1 old replicas pending termination",
+		},
+		{
+			name:    "deployment waiting for availability",
+			obj:     `{"kind": "Deployment", "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 3, "updatedReplicas": 3, "availableReplicas": 2}}`,
+			message: "2 of 3 updated replicas available",
+		},
+		{
+			name:    "deployment done",
+			obj:     `{"kind": "Deployment", "spec": {"replicas": 3}, "status": {"observedGeneration": 3, "replicas": 3, "updatedReplicas": 3, "availableReplicas": 3}}`,
+			done:    true,
+			message: "3 replicas updated and available",
+		},
+		{
+			name: "deployment past its deadline",
+			obj: `{"kind": "Deployment", "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 3, "updatedReplicas": 1,
+				"conditions": [{"type": "Progressing", "reason": "ProgressDeadlineExceeded", "message": "ReplicaSet web-2 has timed out progressing."}]}}`,
+			failed:  true,
+			message: "ReplicaSet web-2 has timed out progressing.",
+		},
+		{
+			name:    "statefulset waiting for readiness",
+			obj:     `{"kind": "StatefulSet", "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "updatedReplicas": 3, "readyReplicas": 2}}`,
+			message: "2 of 3 replicas ready",
+		},
+		{
+			name:    "statefulset waiting for the revision",
+			obj:     `{"kind": "StatefulSet", "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "updatedReplicas": 3, "readyReplicas": 3, "currentRevision": "db-1", "updateRevision": "db-2"}}`,
+			message: "waiting for the update revision to become current",
+		},
+		{
+			name:    "statefulset done",
+			obj:     `{"kind": "StatefulSet", "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "updatedReplicas": 3, "readyReplicas": 3, "currentRevision": "db-2", "updateRevision": "db-2"}}`,
+			done:    true,
+			message: "3 replicas updated and ready",
+		},
+		{
+			name:    "daemonset updating",
+			obj:     `{"kind": "DaemonSet", "status": {"observedGeneration": 2, "desiredNumberScheduled": 5, "updatedNumberScheduled": 2, "numberAvailable": 5}}`,
+			message: "2 of 5 pods updated",
+		},
+		{
+			name:    "daemonset done",
+			obj:     `{"kind": "DaemonSet", "status": {"observedGeneration": 2, "desiredNumberScheduled": 5, "updatedNumberScheduled": 5, "numberAvailable": 5}}`,
+			done:    true,
+			message: "5 pods updated and available",
+		},
+		{
+			name:    "unknown kind",
+			obj:     `{"kind": "ReplicaSet", "status": {"observedGeneration": 2}}`,
+			failed:  true,
+			message: "cannot follow the rollout of a ReplicaSet",
+		},
+	}
+	for _, tt := range tests {
+		done, failed, message := rolloutProgress(workload(t, tt.obj), 2)
+		if done != tt.done || failed != tt.failed || message != tt.message {
+			t.Errorf("%s: rolloutProgress() = %v, %v, %q, want %v, %v, %q", tt.name, done, failed, message, tt.done, tt.failed, tt.message)
+		}
+	}
+}
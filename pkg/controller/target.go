@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	autoscaling "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+// evaluation is the state of one policy for one of its targets at a point in
+// time, before it is combined with the other policies of the target.
+type evaluation struct {
+	policy *api.Policy
+	target *autoscaling.CrossVersionObjectReference
+	status api.PolicyStatus
+	// err is why the target could not be scaled.
+	err error
+
+	// due is the rule with the most recent unmet schedule time, dueTime.
+	due     *api.PolicyRule
+	dueTime time.Time
+	// unmet holds the most recent unmet schedule time of every rule.
+	unmet map[string]time.Time
+
+	// window is the window that decides the scale of the target, active is
+	// set when it is open.
+	window *api.ScalingWindow
+	active bool
+	// replicas is the scale the windows of the policy ask for, if any;
+	// restoring is set when it is the scale the target had before the
+	// windows opened.
+	replicas  *int32
+	restoring bool
+}
+
+// forTarget returns a copy of e for one of the objects the target selector
+// of its policy matches, carrying the replica counts recorded for it.
+func (e *evaluation) forTarget(ref autoscaling.CrossVersionObjectReference) *evaluation {
+	c := *e
+	c.target = &ref
+	c.status = *e.status.DeepCopy()
+	c.status.BaselineReplicas, c.status.AppliedReplicas, c.status.OriginalReplicas = nil, nil, nil
+	c.status.OriginalHorizontalPodAutoscaler, c.status.AppliedWindows, c.status.Rollout = nil, nil, nil
+	if ts := e.policy.Status.TargetStatus(ref.Name); ts != nil {
+		c.status.BaselineReplicas = copyReplicas(ts.BaselineReplicas)
+		c.status.AppliedReplicas = copyReplicas(ts.AppliedReplicas)
+		c.status.OriginalReplicas = copyReplicas(ts.OriginalReplicas)
+		c.status.OriginalHorizontalPodAutoscaler = ts.OriginalHorizontalPodAutoscaler.DeepCopy()
+		c.status.AppliedWindows = copyAppliedWindows(ts.AppliedWindows)
+		c.status.Rollout = ts.Rollout.DeepCopy()
+	}
+	return &c
+}
+
+// claim works out the scale the deciding window asks for.
+func (e *evaluation) claim() {
+	w := e.window
+	if w == nil {
+		return
+	}
+	var replicas *int32
+	switch {
+	case e.active:
+		replicas = &w.Replicas
+	case w.Restore && e.status.OriginalReplicas != nil:
+		replicas, e.restoring = e.status.OriginalReplicas, true
+	default:
+		replicas = w.ReplicasAfter
+	}
+	if replicas != nil {
+		r := clampReplicas(e.policy, *replicas)
+		e.replicas = &r
+	}
+}
+
+// markHandled records the unmet schedule times of e as handled.
+func (e *evaluation) markHandled() {
+	for i := range e.status.Rules {
+		if t, ok := e.unmet[e.status.Rules[i].Name]; ok {
+			e.status.Rules[i].LastScheduleTime = &metav1.Time{Time: t}
+		}
+	}
+}
+
+// targetStatus returns the status of the target of e.
+func (e *evaluation) targetStatus() api.TargetStatus {
+	ts := api.TargetStatus{
+		Name:             e.target.Name,
+		DesiredReplicas:  e.status.DesiredReplicas,
+		BaselineReplicas: e.status.BaselineReplicas,
+		AppliedReplicas:  e.status.AppliedReplicas,
+		OriginalReplicas: e.status.OriginalReplicas,
+
+		OriginalHorizontalPodAutoscaler: e.status.OriginalHorizontalPodAutoscaler,
+		AppliedWindows:                  e.status.AppliedWindows,
+		Rollout:                         e.status.Rollout,
+	}
+	if e.err != nil {
+		ts.Error = e.err.Error()
+	}
+	return ts
+}
+
+// targetKey identifies the object an evaluation scales.
+func targetKey(e *evaluation) string {
+	return fmt.Sprintf("%s/%s/%s", e.policy.Namespace, e.target.Kind, e.target.Name)
+}
+
+// groupByTarget groups evaluations by the object they scale, leaving out
+// the ones without a target. Groups are sorted by target and evaluations by
+// policy name, so that the outcome does not depend on the order of the list.
+func groupByTarget(evals []*evaluation) [][]*evaluation {
+	byKey := map[string][]*evaluation{}
+	keys := []string{}
+	for _, e := range evals {
+		if e.target == nil {
+			continue
+		}
+		key := targetKey(e)
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], e)
+	}
+	sort.Strings(keys)
+
+	groups := make([][]*evaluation, 0, len(keys))
+	for _, key := range keys {
+		group := byKey[key]
+		sort.Slice(group, func(i, j int) bool { return group[i].policy.Name < group[j].policy.Name })
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// combineReplicas combines the scales the policies of one target ask for
+// with the strategy they declare and returns the evaluation whose scale wins.
+// Scales asked for by open windows win over the ones policies return to once
+// their windows have closed. It returns nil when no policy asks for anything.
+func combineReplicas(evals []*evaluation) (*evaluation, error) {
+	strategy := api.Strategy("")
+	for _, e := range evals {
+		s := e.policy.Spec.Strategy
+		if s == "" {
+			continue
+		}
+		if strategy != "" && s != strategy {
+			return nil, fmt.Errorf("policies declare both the %s and the %s strategy", strategy, s)
+		}
+		strategy = s
+	}
+	if strategy == "" {
+		strategy = api.StrategyMax
+	}
+
+	claims := []*evaluation{}
+	active := false
+	for _, e := range evals {
+		if e.replicas == nil {
+			continue
+		}
+		if e.active && !active {
+			claims, active = claims[:0], true
+		}
+		if e.active == active {
+			claims = append(claims, e)
+		}
+	}
+
+	var chosen *evaluation
+	for _, e := range claims {
+		switch {
+		case chosen == nil:
+			chosen = e
+		case strategy == api.StrategyPriority && e.policy.Spec.Priority != chosen.policy.Spec.Priority:
+			if e.policy.Spec.Priority > chosen.policy.Spec.Priority {
+				chosen = e
+			}
+		case strategy == api.StrategyMin:
+			if *e.replicas < *chosen.replicas {
+				chosen = e
+			}
+		default:
+			if *e.replicas > *chosen.replicas {
+				chosen = e
+			}
+		}
+	}
+	return chosen, nil
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+// claim is what one policy of a target asks for in TestCombineReplicas.
+type claim struct {
+	name     string
+	strategy api.Strategy
+	priority int32
+	replicas *int32
+	active   bool
+}
+
+func TestCombineReplicas(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  []claim
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "nothing asked for",
+			claims: []claim{{name: "a"}, {name: "b"}},
+		},
+		{
+			name:   "max by default",
+			claims: []claim{{name: "a", replicas: int32p(3), active: true}, {name: "b", replicas: int32p(5), active: true}},
+			want:   "b",
+		},
+		{
+			name: "min",
+			claims: []claim{
+				{name: "a", strategy: api.StrategyMin, replicas: int32p(3), active: true},
+				{name: "b", strategy: api.StrategyMin, replicas: int32p(5), active: true},
+			},
+			want: "a",
+		},
+		{
+			name: "one policy declares the strategy for all",
+			claims: []claim{
+				{name: "a", replicas: int32p(3), active: true},
+				{name: "b", strategy: api.StrategyMin, replicas: int32p(5), active: true},
+			},
+			want: "a",
+		},
+		{
+			name: "priority",
+			claims: []claim{
+				{name: "a", strategy: api.StrategyPriority, priority: 10, replicas: int32p(2), active: true},
+				{name: "b", strategy: api.StrategyPriority, priority: 1, replicas: int32p(8), active: true},
+			},
+			want: "a",
+		},
+		{
+			name: "priority ties go to the largest",
+			claims: []claim{
+				{name: "a", strategy: api.StrategyPriority, priority: 1, replicas: int32p(2), active: true},
+				{name: "b", strategy: api.StrategyPriority, priority: 1, replicas: int32p(8), active: true},
+			},
+			want: "b",
+		},
+		{
+			name:   "open windows win over closed ones",
+			claims: []claim{{name: "a", replicas: int32p(10)}, {name: "b", replicas: int32p(2), active: true}},
+			want:   "b",
+		},
+		{
+			name:   "closed windows combine when none is open",
+			claims: []claim{{name: "a", replicas: int32p(10)}, {name: "b", replicas: int32p(2)}},
+			want:   "a",
+		},
+		{
+			name: "conflicting strategies",
+			claims: []claim{
+				{name: "a", strategy: api.StrategyMin, replicas: int32p(3), active: true},
+				{name: "b", strategy: api.StrategyMax, replicas: int32p(5), active: true},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		var evals []*evaluation
+		for _, c := range tt.claims {
+			p := &api.Policy{
+				ObjectMeta: metav1.ObjectMeta{Name: c.name, Namespace: "default"},
+				Spec:       api.PolicySpec{Strategy: c.strategy, Priority: c.priority},
+			}
+			evals = append(evals, &evaluation{policy: p, replicas: c.replicas, active: c.active})
+		}
+		chosen, err := combineReplicas(evals)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: combineReplicas() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		got := ""
+		if chosen != nil {
+			got = chosen.policy.Name
+		}
+		if got != tt.want {
+			t.Errorf("%s: combineReplicas() chose %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
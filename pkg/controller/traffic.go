@@ -0,0 +1,315 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/golang/glog"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+// applyTrafficShift sends traffic to the target of e as the open window w
+// asks, once as many endpoints are ready for it as the window scales it to. The
+// window is a scale window too, so the target is warmed up by the scale path
+// while the shift waits, which applied reports. Once shifted, the Service or
+// Ingress is held there until the window closes, and the shift is recorded
+// in applied with what the Service or Ingress had before.
+func (a *TimebasedController) applyTrafficShift(e *evaluation, w *api.ScalingWindow, applied *api.AppliedWindow, reference string) error {
+	ts := w.TrafficShift
+	if ts == nil || (ts.Service == "") == (ts.Ingress == "") {
+		return fmt.Errorf("exactly one of a Service and an Ingress must be set")
+	}
+	if applied.TrafficShift == nil {
+		applied.TrafficShift = &api.AppliedTrafficShift{}
+	}
+	shift := applied.TrafficShift
+	if shift.Time == nil {
+		want := clampReplicas(e.policy, w.Replicas)
+		ready, err := a.readyEndpoints(e.policy.Namespace, ts)
+		if err != nil {
+			return err
+		}
+		if ready < want {
+			shift.Message = fmt.Sprintf("%d of %d endpoints for %s are ready", ready, want, reference)
+			glog.V(4).Infof("window %s of policy %s/%s waits to shift traffic: %s", w.Name, e.policy.Namespace, e.policy.Name, shift.Message)
+			return nil
+		}
+	}
+
+	var err error
+	if ts.Service != "" {
+		err = a.shiftService(e, w, shift, reference)
+	} else {
+		err = a.shiftIngress(e, w, shift, reference)
+	}
+	if err != nil {
+		return err
+	}
+	if shift.Time == nil {
+		now := metav1.Now()
+		shift.TrafficShift = *ts.DeepCopy()
+		shift.Time, shift.Message = &now, ""
+	}
+	return nil
+}
+
+// shiftService sets the selector of the Service of the open window w,
+// recording the one it had before in shift the first time.
+func (a *TimebasedController) shiftService(e *evaluation, w *api.ScalingWindow, shift *api.AppliedTrafficShift, reference string) error {
+	services := a.cfg.Client.CoreV1().Services(e.policy.Namespace)
+	svc, err := services.Get(w.TrafficShift.Service, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if shift.Time == nil {
+		shift.OriginalSelector = copyLabels(svc.Spec.Selector)
+	}
+	if equality.Semantic.DeepEqual(svc.Spec.Selector, w.TrafficShift.Selector) {
+		return nil
+	}
+	glog.V(2).Infof("window %s of policy %s/%s shifts the traffic of Service %s to %s", w.Name, e.policy.Namespace, e.policy.Name, svc.Name, reference)
+	svc.Spec.Selector = copyLabels(w.TrafficShift.Selector)
+	_, err = services.Update(svc)
+	return err
+}
+
+// shiftIngress sets the weight of the Ingress of the open window w,
+// recording the one it had before in shift the first time.
+func (a *TimebasedController) shiftIngress(e *evaluation, w *api.ScalingWindow, shift *api.AppliedTrafficShift, reference string) error {
+	ts := w.TrafficShift
+	if ts.Weight == nil {
+		return fmt.Errorf("no weight is set")
+	}
+	ref := ingressRef(ts.Ingress)
+	obj, err := a.objects.Get(e.policy.Namespace, ref)
+	if err != nil {
+		return err
+	}
+	annotation := weightAnnotation(ts)
+	current, ok := obj.GetAnnotations()[annotation]
+	if shift.Time == nil {
+		shift.OriginalWeight = nil
+		if ok {
+			shift.OriginalWeight = &current
+		}
+	}
+	weight := strconv.Itoa(int(*ts.Weight))
+	if ok && current == weight {
+		return nil
+	}
+	glog.V(2).Infof("window %s of policy %s/%s gives %s a weight of %s in Ingress %s", w.Name, e.policy.Namespace, e.policy.Name, reference, weight, ts.Ingress)
+	return a.setIngressWeight(e, ref, annotation, &weight)
+}
+
+// revertTrafficShift moves the traffic recorded in applied back to where it
+// went before the window shifted it. A shift that was never made has nothing
+// to revert, and neither has a Service or Ingress that is gone.
+func (a *TimebasedController) revertTrafficShift(e *evaluation, applied *api.AppliedWindow, reference string) error {
+	shift := applied.TrafficShift
+	if shift.Time == nil {
+		return nil
+	}
+	ts := &shift.TrafficShift
+
+	if ts.Service != "" {
+		services := a.cfg.Client.CoreV1().Services(e.policy.Namespace)
+		svc, err := services.Get(ts.Service, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if equality.Semantic.DeepEqual(svc.Spec.Selector, shift.OriginalSelector) {
+			return nil
+		}
+		glog.V(2).Infof("window %s of policy %s/%s shifts the traffic of Service %s back from %s", applied.Name, e.policy.Namespace, e.policy.Name, svc.Name, reference)
+		svc.Spec.Selector = copyLabels(shift.OriginalSelector)
+		_, err = services.Update(svc)
+		return err
+	}
+
+	ref := ingressRef(ts.Ingress)
+	obj, err := a.objects.Get(e.policy.Namespace, ref)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	annotation := weightAnnotation(ts)
+	current, ok := obj.GetAnnotations()[annotation]
+	if shift.OriginalWeight == nil && !ok || shift.OriginalWeight != nil && ok && current == *shift.OriginalWeight {
+		return nil
+	}
+	glog.V(2).Infof("window %s of policy %s/%s puts back the weight of %s in Ingress %s", applied.Name, e.policy.Namespace, e.policy.Name, reference, ts.Ingress)
+	return a.setIngressWeight(e, ref, annotation, shift.OriginalWeight)
+}
+
+// readyEndpoints counts the ready endpoints the traffic ts shifts would go
+// to, as cached by the informers. Those of an Ingress are the ready addresses
+// of the Endpoints of the Services it routes to, counted for the one with the
+// fewest. Those of a Service are the ready pods its new selector matches,
+// which are its endpoints once the selector is set.
+func (a *TimebasedController) readyEndpoints(namespace string, ts *api.TrafficShift) (int32, error) {
+	if ts.Service != "" {
+		objs, err := a.podInformer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+		if err != nil {
+			return 0, err
+		}
+		selector := labels.SelectorFromSet(ts.Selector)
+		var ready int32
+		for _, obj := range objs {
+			pod := obj.(*corev1.Pod)
+			if pod.DeletionTimestamp == nil && selector.Matches(labels.Set(pod.Labels)) && podReady(pod) {
+				ready++
+			}
+		}
+		return ready, nil
+	}
+
+	obj, err := a.objects.Get(namespace, ingressRef(ts.Ingress))
+	if err != nil {
+		return 0, err
+	}
+	services, err := ingressServices(obj)
+	if err != nil {
+		return 0, fmt.Errorf("Ingress %s: %v", ts.Ingress, err)
+	}
+	if len(services) == 0 {
+		return 0, fmt.Errorf("Ingress %s routes to no Service", ts.Ingress)
+	}
+	ready := int32(-1)
+	for _, name := range services {
+		var n int32
+		item, exists, err := a.endpointsInformer.GetStore().GetByKey(namespace + "/" + name)
+		if err != nil {
+			return 0, err
+		}
+		if exists {
+			for _, subset := range item.(*corev1.Endpoints).Subsets {
+				n += int32(len(subset.Addresses))
+			}
+		}
+		if ready < 0 || n < ready {
+			ready = n
+		}
+	}
+	return ready, nil
+}
+
+// ingressBackend is the backend of an Ingress, in the fields of both the
+// extensions/v1beta1 and the networking.k8s.io/v1 versions.
+type ingressBackend struct {
+	ServiceName string `json:"serviceName,omitempty"`
+	Service     *struct {
+		Name string `json:"name"`
+	} `json:"service,omitempty"`
+}
+
+// ingressServices returns the names of the Services the Ingress obj routes
+// to, sorted.
+func ingressServices(obj *unstructured.Unstructured) ([]string, error) {
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return nil, err
+	}
+	var ing struct {
+		Spec struct {
+			Backend        *ingressBackend `json:"backend,omitempty"`
+			DefaultBackend *ingressBackend `json:"defaultBackend,omitempty"`
+			Rules          []struct {
+				HTTP *struct {
+					Paths []struct {
+						Backend ingressBackend `json:"backend"`
+					} `json:"paths"`
+				} `json:"http,omitempty"`
+			} `json:"rules,omitempty"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(data, &ing); err != nil {
+		return nil, err
+	}
+	backends := []*ingressBackend{ing.Spec.Backend, ing.Spec.DefaultBackend}
+	for _, r := range ing.Spec.Rules {
+		if r.HTTP == nil {
+			continue
+		}
+		for i := range r.HTTP.Paths {
+			backends = append(backends, &r.HTTP.Paths[i].Backend)
+		}
+	}
+	names := sets.NewString()
+	for _, b := range backends {
+		switch {
+		case b == nil:
+		case b.ServiceName != "":
+			names.Insert(b.ServiceName)
+		case b.Service != nil && b.Service.Name != "":
+			names.Insert(b.Service.Name)
+		}
+	}
+	return names.List(), nil
+}
+
+// podReady reports whether pod is ready to serve, and so is an endpoint of
+// the Services selecting it.
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// setIngressWeight sets the weight annotation of the Ingress ref points at,
+// or removes it when weight is nil.
+func (a *TimebasedController) setIngressWeight(e *evaluation, ref autoscaling.CrossVersionObjectReference, annotation string, weight *string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{annotation: weight},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = a.objects.Patch(e.policy.Namespace, ref, types.MergePatchType, patch)
+	return err
+}
+
+// ingressRef points at the named Ingress in whichever API version the
+// apiserver prefers.
+func ingressRef(name string) autoscaling.CrossVersionObjectReference {
+	return autoscaling.CrossVersionObjectReference{Kind: "Ingress", Name: name}
+}
+
+func weightAnnotation(ts *api.TrafficShift) string {
+	if ts.WeightAnnotation != "" {
+		return ts.WeightAnnotation
+	}
+	return api.DefaultWeightAnnotation
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
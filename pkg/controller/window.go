@@ -0,0 +1,351 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/robfig/cron"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"github.com/hchenxa/timebase/pkg/schedule"
+)
+
+// lookbacks are the spans searched, shortest first, for the most recent
+// start of a window. A window that has not started within a year counts as
+// closed.
+var lookbacks = []time.Duration{
+	time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+	31 * 24 * time.Hour,
+	366 * 24 * time.Hour,
+}
+
+// lastActivation returns the most recent activation of sched at or before
+// now, or the zero time if there was none within the longest lookback.
+func lastActivation(sched cron.Schedule, now time.Time) time.Time {
+	for _, lookback := range lookbacks {
+		var last time.Time
+		for t := sched.Next(now.Add(-lookback)); !t.IsZero() && !t.After(now); t = sched.Next(t) {
+			last = t
+		}
+		if !last.IsZero() {
+			return last
+		}
+	}
+	return time.Time{}
+}
+
+// getWindowStatus computes the state of window w of policy p at now. The
+// window opens lead ahead of its start, and still closes at its end.
+func getWindowStatus(p *api.Policy, w *api.ScalingWindow, now time.Time, lead time.Duration) (api.WindowStatus, error) {
+	status := api.WindowStatus{Name: w.Name}
+
+	start, err := schedule.Parse(w.Start, p.Spec.TimeZone)
+	if err != nil {
+		return status, err
+	}
+	var end cron.Schedule
+	switch {
+	case w.End != "" && w.Duration != nil:
+		return status, fmt.Errorf("window %s sets both an end and a duration", w.Name)
+	case w.End != "":
+		if end, err = schedule.Parse(w.End, p.Spec.TimeZone); err != nil {
+			return status, err
+		}
+	case w.Duration == nil || w.Duration.Duration <= 0:
+		return status, fmt.Errorf("window %s needs an end or a positive duration", w.Name)
+	}
+	endOf := func(t time.Time) time.Time {
+		if end != nil {
+			return end.Next(t)
+		}
+		return t.Add(w.Duration.Duration)
+	}
+
+	at := now.Add(lead)
+	if last := lastActivation(start, at); !last.IsZero() {
+		until := endOf(last)
+		status.StartTime = &metav1.Time{Time: last}
+		if !until.IsZero() {
+			status.EndTime = &metav1.Time{Time: until}
+		}
+		status.Active = until.IsZero() || now.Before(until)
+	}
+	if next := start.Next(at); !next.IsZero() {
+		status.NextStartTime = &metav1.Time{Time: next}
+	}
+	return status, nil
+}
+
+// getDecidingWindow returns the window whose scale the target should have
+// at the time the statuses were computed. An open window wins over a closed
+// one, and among open windows the one opened last wins. When every window is
+// closed, the one closed last decides. active reports whether it is open.
+func getDecidingWindow(p *api.Policy, statuses []api.WindowStatus) (w *api.ScalingWindow, active bool) {
+	var decidedBy *api.WindowStatus
+	for i := range statuses {
+		ws := &statuses[i]
+		if w := window(p, ws.Name); w == nil || !isScaleWindow(w) {
+			continue
+		}
+		switch {
+		case decidedBy == nil:
+			decidedBy = ws
+		case ws.Active:
+			if !decidedBy.Active || ws.StartTime.Time.After(decidedBy.StartTime.Time) {
+				decidedBy = ws
+			}
+		case !decidedBy.Active && closedAt(ws).After(closedAt(decidedBy)):
+			decidedBy = ws
+		}
+	}
+	if decidedBy == nil {
+		return nil, false
+	}
+	return window(p, decidedBy.Name), decidedBy.Active
+}
+
+// window returns the named window of p, or nil if it has none.
+func window(p *api.Policy, name string) *api.ScalingWindow {
+	for i := range p.Spec.Windows {
+		if p.Spec.Windows[i].Name == name {
+			return &p.Spec.Windows[i]
+		}
+	}
+	return nil
+}
+
+// isScaleWindow reports whether w holds the target at a scale. Traffic
+// shift windows do, to warm the target up before sending it traffic.
+func isScaleWindow(w *api.ScalingWindow) bool {
+	return w.Action == "" || w.Action == api.ScaleWindow || w.Action == api.TrafficShiftWindow
+}
+
+// isTargetWindow reports whether w changes its target other than by scaling
+// it, which applyWindows takes care of.
+func isTargetWindow(w *api.ScalingWindow) bool {
+	return w.Action != "" && w.Action != api.ScaleWindow && !isPolicyWindow(w)
+}
+
+// isPolicyWindow reports whether w acts on its own rather than on the
+// targets of its policy, once per policy.
+func isPolicyWindow(w *api.ScalingWindow) bool {
+	return w.Action == api.ManifestsWindow || w.Action == api.NodeMaintenanceWindow || w.Action == api.QuotaWindow
+}
+
+// needsTarget reports whether p acts on a target, rather than only having
+// windows and rules that act on their own.
+func needsTarget(p *api.Policy) bool {
+	if len(p.Spec.Rules) == 0 && len(p.Spec.Windows) == 0 {
+		return true
+	}
+	for i := range p.Spec.Rules {
+		if p.Spec.Rules[i].Action != api.MaintainNodes {
+			return true
+		}
+	}
+	for i := range p.Spec.Windows {
+		if !isPolicyWindow(&p.Spec.Windows[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasScaleWindows reports whether p has a window that holds the target at a
+// scale, and so takes part in choosing it.
+func hasScaleWindows(p *api.Policy) bool {
+	for i := range p.Spec.Windows {
+		if isScaleWindow(&p.Spec.Windows[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// closedAt returns when the most recent occurrence of a closed window ended,
+// or the zero time if it has not occurred.
+func closedAt(ws *api.WindowStatus) time.Time {
+	if ws.EndTime == nil {
+		return time.Time{}
+	}
+	return ws.EndTime.Time
+}
+
+// nextWindowTransition returns the earliest time any window opens or closes
+// after the time the statuses were computed.
+func nextWindowTransition(statuses []api.WindowStatus) *metav1.Time {
+	var next *metav1.Time
+	for _, ws := range statuses {
+		t := ws.NextStartTime
+		if ws.Active && ws.EndTime != nil && (t == nil || ws.EndTime.Time.Before(t.Time)) {
+			t = ws.EndTime
+		}
+		if t != nil && (next == nil || t.Time.Before(next.Time)) {
+			next = t
+		}
+	}
+	return next.DeepCopy()
+}
+
+// scaleTo sets the scale of the target of e to replicas, unless it is there
+// already, and returns the scale it had before. The target is shared by every
+// evaluation of its group.
+func (a *TimebasedController) scaleTo(e *evaluation, replicas int32, reference string) (int32, error) {
+	p := e.policy
+	scale, err := a.scales.Get(p.ObjectMeta.Namespace, *e.target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query scale subresource: %v", err)
+	}
+	previous := scale.Spec.Replicas
+	if previous == replicas {
+		return previous, nil
+	}
+
+	glog.V(2).Infof("windows scale %s from %d to %d", reference, previous, replicas)
+	scale.Spec.Replicas = replicas
+	_, err = a.scales.Update(p.ObjectMeta.Namespace, *e.target, scale)
+	return previous, err
+}
+
+// recordOriginalReplicas keeps the scale the target had before the windows
+// of a policy opened, so that they can restore it once closed. applied is the
+// scale the target was just set to and previous the one it had before, both
+// are nil when the target was not touched.
+func recordOriginalReplicas(evals []*evaluation, applied, previous *int32) {
+	for _, e := range evals {
+		if !hasScaleWindows(e.policy) {
+			continue
+		}
+		switch {
+		case e.active:
+			if e.status.OriginalReplicas == nil && previous != nil {
+				e.status.OriginalReplicas = copyReplicas(previous)
+			}
+		case !e.restoring:
+			e.status.OriginalReplicas = nil
+		case applied != nil && *applied == *e.replicas:
+			e.status.OriginalReplicas = nil
+		}
+	}
+}
+
+// applyWindows makes the open windows of e that do not scale its target
+// take effect on it, and undoes the change of the ones that have closed or
+// are gone from the spec. Like scale windows they are level triggered: a
+// target that drifts while a window is open is corrected on the next pass.
+// Patches are the exception, they are applied once each time their window
+// opens.
+func (a *TimebasedController) applyWindows(e *evaluation, reference string) {
+	open := sets.NewString()
+	for _, ws := range e.status.Windows {
+		if w := window(e.policy, ws.Name); ws.Active && w != nil && isTargetWindow(w) {
+			open.Insert(ws.Name)
+		}
+	}
+
+	var errs []error
+	for i := range e.policy.Spec.Windows {
+		w := &e.policy.Spec.Windows[i]
+		if !open.Has(w.Name) {
+			continue
+		}
+		applied := e.status.AppliedWindow(w.Name)
+		if applied == nil {
+			e.status.AppliedWindows = append(e.status.AppliedWindows, api.AppliedWindow{Name: w.Name})
+			applied = &e.status.AppliedWindows[len(e.status.AppliedWindows)-1]
+		}
+		if err := a.applyWindow(e, w, applied, reference); err != nil {
+			errs = append(errs, fmt.Errorf("window %s: %v", w.Name, err))
+		}
+	}
+
+	var kept []api.AppliedWindow
+	for _, applied := range e.status.AppliedWindows {
+		if open.Has(applied.Name) {
+			kept = append(kept, applied)
+			continue
+		}
+		glog.V(2).Infof("window %s of policy %s/%s has closed, undoing its change to %s", applied.Name, e.policy.Namespace, e.policy.Name, reference)
+		if err := a.undoWindow(e, &applied, reference); err != nil {
+			errs = append(errs, fmt.Errorf("window %s: %v", applied.Name, err))
+			kept = append(kept, applied)
+		}
+	}
+	e.status.AppliedWindows = kept
+
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		glog.Errorf("failed to apply the windows of policy %s/%s to %s: %v", e.policy.Namespace, e.policy.Name, reference, err)
+		e.err = err
+	}
+}
+
+// applyWindow makes the open window w of e take effect on its target,
+// recording in applied what it takes to undo it.
+func (a *TimebasedController) applyWindow(e *evaluation, w *api.ScalingWindow, applied *api.AppliedWindow, reference string) error {
+	switch w.Action {
+	case api.ResourcesWindow:
+		return a.applyResources(e, w, applied, reference)
+	case api.SuspendWindow:
+		return a.applySuspend(e, w, applied, reference)
+	case api.ParallelismWindow:
+		return a.applyParallelism(e, w, applied, reference)
+	case api.PatchWindow:
+		return a.applyPatch(e, w, applied, reference)
+	case api.TrafficShiftWindow:
+		return a.applyTrafficShift(e, w, applied, reference)
+	}
+	return fmt.Errorf("unknown action %q", w.Action)
+}
+
+// undoWindow undoes the change recorded in applied. It only needs what was
+// recorded, so that windows removed from the spec are undone as well.
+func (a *TimebasedController) undoWindow(e *evaluation, applied *api.AppliedWindow, reference string) error {
+	var errs []error
+	if len(applied.Resources) > 0 {
+		errs = append(errs, a.restoreResources(e, applied, reference))
+	}
+	if applied.Suspend != nil {
+		errs = append(errs, a.restoreSuspend(e, applied, reference))
+	}
+	if applied.Parallelism != nil {
+		errs = append(errs, a.restoreParallelism(e, applied, reference))
+	}
+	if applied.Patch != nil {
+		errs = append(errs, a.revertPatch(e, applied, reference))
+	}
+	if applied.TrafficShift != nil {
+		errs = append(errs, a.revertTrafficShift(e, applied, reference))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// hasAppliedWindows reports whether status records a window whose change to
+// a target, or whose objects, are still in place.
+func hasAppliedWindows(status *api.PolicyStatus) bool {
+	if len(status.AppliedWindows) > 0 || len(status.Manifests) > 0 || len(status.NodeMaintenance) > 0 || len(status.Quotas) > 0 {
+		return true
+	}
+	for _, ts := range status.Targets {
+		if len(ts.AppliedWindows) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func copyAppliedWindows(windows []api.AppliedWindow) []api.AppliedWindow {
+	if windows == nil {
+		return nil
+	}
+	c := make([]api.AppliedWindow, len(windows))
+	for i := range windows {
+		windows[i].DeepCopyInto(&c[i])
+	}
+	return c
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+func at(s string) *metav1.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return &metav1.Time{Time: t}
+}
+
+func TestGetDecidingWindow(t *testing.T) {
+	windows := []api.ScalingWindow{
+		{Name: "morning"},
+		{Name: "day", Action: api.ScaleWindow},
+		{Name: "night"},
+		{Name: "shift", Action: api.TrafficShiftWindow},
+		{Name: "quota", Action: api.QuotaWindow},
+		{Name: "resources", Action: api.ResourcesWindow},
+	}
+	tests := []struct {
+		name       string
+		statuses   []api.WindowStatus
+		want       string
+		wantActive bool
+	}{
+		{
+			name: "no windows",
+		},
+		{
+			name: "open wins over closed",
+			statuses: []api.WindowStatus{
+				{Name: "morning", StartTime: at("2024-05-06T06:00:00Z"), EndTime: at("2024-05-06T09:00:00Z")},
+				{Name: "day", Active: true, StartTime: at("2024-05-06T05:00:00Z"), EndTime: at("2024-05-06T18:00:00Z")},
+			},
+			want:       "day",
+			wantActive: true,
+		},
+		{
+			name: "opened last wins among open windows",
+			statuses: []api.WindowStatus{
+				{Name: "day", Active: true, StartTime: at("2024-05-06T08:00:00Z"), EndTime: at("2024-05-06T18:00:00Z")},
+				{Name: "morning", Active: true, StartTime: at("2024-05-06T09:00:00Z"), EndTime: at("2024-05-06T12:00:00Z")},
+			},
+			want:       "morning",
+			wantActive: true,
+		},
+		{
+			name: "closed last decides when all are closed",
+			statuses: []api.WindowStatus{
+				{Name: "night", StartTime: at("2024-05-05T20:00:00Z"), EndTime: at("2024-05-06T06:00:00Z")},
+				{Name: "day", StartTime: at("2024-05-05T08:00:00Z"), EndTime: at("2024-05-05T18:00:00Z")},
+			},
+			want: "night",
+		},
+		{
+			name: "a window that never occurred decides only alone",
+			statuses: []api.WindowStatus{
+				{Name: "morning"},
+				{Name: "day", StartTime: at("2024-05-05T08:00:00Z"), EndTime: at("2024-05-05T18:00:00Z")},
+			},
+			want: "day",
+		},
+		{
+			name: "traffic shift windows scale",
+			statuses: []api.WindowStatus{
+				{Name: "day", Active: true, StartTime: at("2024-05-06T08:00:00Z"), EndTime: at("2024-05-06T18:00:00Z")},
+				{Name: "shift", Active: true, StartTime: at("2024-05-06T10:00:00Z"), EndTime: at("2024-05-06T11:00:00Z")},
+			},
+			want:       "shift",
+			wantActive: true,
+		},
+		{
+			name: "windows that do not scale are left out",
+			statuses: []api.WindowStatus{
+				{Name: "quota", Active: true, StartTime: at("2024-05-06T10:00:00Z"), EndTime: at("2024-05-06T11:00:00Z")},
+				{Name: "resources", Active: true, StartTime: at("2024-05-06T10:00:00Z"), EndTime: at("2024-05-06T11:00:00Z")},
+				{Name: "night", StartTime: at("2024-05-05T20:00:00Z"), EndTime: at("2024-05-06T06:00:00Z")},
+			},
+			want: "night",
+		},
+		{
+			name: "windows gone from the spec are left out",
+			statuses: []api.WindowStatus{
+				{Name: "removed", Active: true, StartTime: at("2024-05-06T10:00:00Z"), EndTime: at("2024-05-06T11:00:00Z")},
+			},
+		},
+	}
+	p := &api.Policy{Spec: api.PolicySpec{Windows: windows}}
+	for _, tt := range tests {
+		w, active := getDecidingWindow(p, tt.statuses)
+		got := ""
+		if w != nil {
+			got = w.Name
+		}
+		if got != tt.want || active != tt.wantActive {
+			t.Errorf("%s: getDecidingWindow() = %q, %v, want %q, %v", tt.name, got, active, tt.want, tt.wantActive)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package cronjob lists, suspends and resumes CronJobs in whichever version
+// of the batch group the apiserver serves them, found through discovery.
+package cronjob
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/hchenxa/timebase/pkg/apiresource"
+)
+
+// versions are the versions of the batch group that served CronJobs, most
+// recent first.
+var versions = []string{"batch/v1", "batch/v1beta1", "batch/v2alpha1"}
+
+// CronJob is the part of a CronJob the controller acts on.
+type CronJob struct {
+	Name    string
+	Suspend bool
+}
+
+// Interface lists CronJobs and sets whether they are suspended.
+type Interface interface {
+	Get(namespace, name string) (*CronJob, error)
+	List(namespace string) ([]CronJob, error)
+	SetSuspend(namespace, name string, suspend bool) error
+}
+
+type client struct {
+	resolver *apiresource.Resolver
+	rest     rest.Interface
+}
+
+// New returns a CronJob client that talks to the apiserver of kubeClient.
+func New(kubeClient kubernetes.Interface) Interface {
+	return &client{
+		resolver: apiresource.NewResolver(kubeClient.Discovery(), nil, ""),
+		rest:     kubeClient.Discovery().RESTClient(),
+	}
+}
+
+// item is the part of a served CronJob the controller reads.
+type item struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Suspend *bool `json:"suspend"`
+	} `json:"spec"`
+}
+
+func (i *item) cronJob() CronJob {
+	return CronJob{
+		Name:    i.Metadata.Name,
+		Suspend: i.Spec.Suspend != nil && *i.Spec.Suspend,
+	}
+}
+
+// Get returns the named CronJob in namespace.
+func (c *client) Get(namespace, name string) (*CronJob, error) {
+	p, err := c.path(namespace)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := c.rest.Get().AbsPath(p, name).DoRaw()
+	if err != nil {
+		c.resolver.Forget(err)
+		return nil, err
+	}
+	var i item
+	if err := json.Unmarshal(raw, &i); err != nil {
+		return nil, err
+	}
+	job := i.cronJob()
+	return &job, nil
+}
+
+// List returns the CronJobs in namespace.
+func (c *client) List(namespace string) ([]CronJob, error) {
+	p, err := c.path(namespace)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := c.rest.Get().AbsPath(p).DoRaw()
+	if err != nil {
+		c.resolver.Forget(err)
+		return nil, err
+	}
+	list := struct {
+		Items []item `json:"items"`
+	}{}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	jobs := make([]CronJob, 0, len(list.Items))
+	for i := range list.Items {
+		jobs = append(jobs, list.Items[i].cronJob())
+	}
+	return jobs, nil
+}
+
+// SetSuspend suspends the named CronJob in namespace, or resumes it.
+func (c *client) SetSuspend(namespace, name string, suspend bool) error {
+	p, err := c.path(namespace)
+	if err != nil {
+		return err
+	}
+	patch := fmt.Sprintf(`{"spec":{"suspend":%t}}`, suspend)
+	if _, err := c.rest.Patch(types.MergePatchType).AbsPath(p, name).Body([]byte(patch)).DoRaw(); err != nil {
+		c.resolver.Forget(err)
+		return err
+	}
+	return nil
+}
+
+// path returns the path of the CronJobs in namespace.
+func (c *client) path(namespace string) (string, error) {
+	r, err := c.resolver.ResolveFirst(versions, "CronJob")
+	if err != nil {
+		return "", err
+	}
+	return r.Path(namespace), nil
+}
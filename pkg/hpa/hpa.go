@@ -0,0 +1,241 @@
+// Package hpa finds the HorizontalPodAutoscaler of a scale target and
+// changes its bounds, in whichever version of the autoscaling group the
+// apiserver serves with a CPU utilization target, found through discovery.
+// HorizontalPodAutoscalers are found in a cache kept up to date by watching
+// them in autoscaling/v1, which every apiserver that serves them serves.
+package hpa
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	autoscaling "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	"github.com/hchenxa/timebase/pkg/apiresource"
+	"github.com/hchenxa/timebase/pkg/object"
+)
+
+// versions are the versions of the autoscaling group the controller
+// understands, most recent first. autoscaling/v1 keeps the CPU utilization
+// target in a field of its own, the others in a metric.
+var versions = []string{"autoscaling/v2", "autoscaling/v2beta2", "autoscaling/v1"}
+
+// HorizontalPodAutoscaler is the part of a HorizontalPodAutoscaler the
+// controller acts on.
+type HorizontalPodAutoscaler struct {
+	Name   string
+	Bounds api.HorizontalPodAutoscalerBounds
+}
+
+// Interface finds HorizontalPodAutoscalers and sets their bounds.
+type Interface interface {
+	// Find returns the HorizontalPodAutoscaler that scales the object ref
+	// points at in namespace, or nil if there is none or the apiserver
+	// serves no HorizontalPodAutoscalers.
+	Find(namespace string, ref autoscaling.CrossVersionObjectReference) (*HorizontalPodAutoscaler, error)
+	// SetBounds sets the bounds of the named HorizontalPodAutoscaler in
+	// namespace. A nil minimum or CPU utilization target is removed, a nil
+	// maximum is left as it is.
+	SetBounds(namespace, name string, bounds api.HorizontalPodAutoscalerBounds) error
+	// Run fills the cache Find looks in until stopCh is closed.
+	Run(stopCh <-chan struct{})
+	// HasSynced reports whether the cache has been filled, or whether the
+	// apiserver serves no HorizontalPodAutoscalers to fill it with.
+	HasSynced() bool
+}
+
+// targetIndex indexes HorizontalPodAutoscalers by their scale target.
+const targetIndex = "scaleTargetRef"
+
+type client struct {
+	resolver *apiresource.Resolver
+	rest     rest.Interface
+	informer cache.SharedIndexInformer
+}
+
+// New returns a HorizontalPodAutoscaler client that talks to the apiserver
+// of kubeClient, and lists them again every resyncPeriod.
+func New(kubeClient kubernetes.Interface, resyncPeriod time.Duration) Interface {
+	autoscalers := kubeClient.AutoscalingV1().HorizontalPodAutoscalers(metav1.NamespaceAll)
+	return &client{
+		resolver: apiresource.NewResolver(kubeClient.Discovery(), nil, ""),
+		rest:     kubeClient.Discovery().RESTClient(),
+		informer: cache.NewSharedIndexInformer(
+			&cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return autoscalers.List(options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return autoscalers.Watch(options)
+				},
+			},
+			&autoscaling.HorizontalPodAutoscaler{},
+			resyncPeriod,
+			cache.Indexers{targetIndex: indexByTarget},
+		),
+	}
+}
+
+// Run fills the cache Find looks in until stopCh is closed.
+func (c *client) Run(stopCh <-chan struct{}) {
+	c.informer.Run(stopCh)
+}
+
+// HasSynced reports whether the cache has been filled, or whether the
+// apiserver serves no HorizontalPodAutoscalers to fill it with.
+func (c *client) HasSynced() bool {
+	if c.informer.HasSynced() {
+		return true
+	}
+	_, _, err := c.path(metav1.NamespaceAll)
+	return apiresource.IsNotServed(err)
+}
+
+// indexByTarget indexes a HorizontalPodAutoscaler by the kind and name of
+// its scale target in its namespace.
+func indexByTarget(obj interface{}) ([]string, error) {
+	h, ok := obj.(*autoscaling.HorizontalPodAutoscaler)
+	if !ok {
+		return nil, nil
+	}
+	return []string{targetKey(h.Namespace, h.Spec.ScaleTargetRef.Kind, h.Spec.ScaleTargetRef.Name)}, nil
+}
+
+func targetKey(namespace, kind, name string) string {
+	return namespace + "/" + kind + "/" + name
+}
+
+// Find returns the HorizontalPodAutoscaler that scales the object ref points
+// at in namespace. The API version of the reference is not compared, an
+// autoscaler may name the target in another version of its group.
+func (c *client) Find(namespace string, ref autoscaling.CrossVersionObjectReference) (*HorizontalPodAutoscaler, error) {
+	if !c.informer.HasSynced() {
+		if _, _, err := c.path(namespace); apiresource.IsNotServed(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("the HorizontalPodAutoscalers have not been listed yet")
+	}
+	items, err := c.informer.GetIndexer().ByIndex(targetIndex, targetKey(namespace, ref.Kind, ref.Name))
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		h := item.(*autoscaling.HorizontalPodAutoscaler)
+		max := h.Spec.MaxReplicas
+		return &HorizontalPodAutoscaler{
+			Name: h.Name,
+			Bounds: api.HorizontalPodAutoscalerBounds{
+				MinReplicas:                    copyInt(h.Spec.MinReplicas),
+				MaxReplicas:                    &max,
+				TargetCPUUtilizationPercentage: copyInt(h.Spec.TargetCPUUtilizationPercentage),
+			},
+		}, nil
+	}
+	return nil, nil
+}
+
+// SetBounds sets the bounds of the named HorizontalPodAutoscaler in
+// namespace. The object is read and written back whole, so that fields the
+// controller does not know about are kept.
+func (c *client) SetBounds(namespace, name string, b api.HorizontalPodAutoscalerBounds) error {
+	p, version, err := c.path(namespace)
+	if err != nil {
+		return err
+	}
+	p = path.Join(p, name)
+	raw, err := c.rest.Get().AbsPath(p).DoRaw()
+	if err != nil {
+		c.resolver.Forget(err)
+		return err
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(raw); err != nil {
+		return err
+	}
+	spec, _ := obj.Object["spec"].(map[string]interface{})
+	if spec == nil {
+		return fmt.Errorf("HorizontalPodAutoscaler %s/%s has no spec", namespace, name)
+	}
+	setInt(spec, "minReplicas", b.MinReplicas)
+	if b.MaxReplicas != nil {
+		setInt(spec, "maxReplicas", b.MaxReplicas)
+	}
+	if version == "autoscaling/v1" {
+		setInt(spec, "targetCPUUtilizationPercentage", b.TargetCPUUtilizationPercentage)
+	} else {
+		setCPUMetric(spec, b.TargetCPUUtilizationPercentage)
+	}
+
+	body, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = c.rest.Put().AbsPath(p).Body(body).DoRaw()
+	return err
+}
+
+// setCPUMetric sets the CPU utilization target of an autoscaling/v2 spec,
+// or removes its metric when utilization is nil.
+func setCPUMetric(spec map[string]interface{}, utilization *int32) {
+	metrics, _ := spec["metrics"].([]interface{})
+	kept := make([]interface{}, 0, len(metrics)+1)
+	for _, item := range metrics {
+		m, _ := item.(map[string]interface{})
+		if m["type"] == "Resource" && object.Field(m, "resource", "name") == "cpu" && object.Field(m, "resource", "target", "type") == "Utilization" {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	if utilization != nil {
+		kept = append(kept, map[string]interface{}{
+			"type": "Resource",
+			"resource": map[string]interface{}{
+				"name": "cpu",
+				"target": map[string]interface{}{
+					"type":               "Utilization",
+					"averageUtilization": int64(*utilization),
+				},
+			},
+		})
+	}
+	if len(kept) == 0 {
+		delete(spec, "metrics")
+		return
+	}
+	spec["metrics"] = kept
+}
+
+func copyInt(value *int32) *int32 {
+	if value == nil {
+		return nil
+	}
+	v := *value
+	return &v
+}
+
+func setInt(m map[string]interface{}, key string, value *int32) {
+	if value == nil {
+		delete(m, key)
+		return
+	}
+	m[key] = int64(*value)
+}
+
+// path returns the path of the HorizontalPodAutoscalers in namespace and
+// the version they are served in.
+func (c *client) path(namespace string) (string, string, error) {
+	r, err := c.resolver.ResolveFirst(versions, "HorizontalPodAutoscaler")
+	if err != nil {
+		return "", "", err
+	}
+	return r.Path(namespace), r.GroupVersion.String(), nil
+}
@@ -0,0 +1,204 @@
+// Package migrate moves Policy objects that were stored under the legacy
+// policy.icp.ibm.com ThirdPartyResource to the Policy CustomResourceDefinition.
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	api "github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1"
+	"github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+	typed "github.com/hchenxa/timebase/pkg/client/clientset/versioned/typed/icp/v1beta2"
+)
+
+// LegacyStatus is the status as the ThirdPartyResource stored it, nested in
+// the spec.
+type LegacyStatus struct {
+	CreationTimestamp *metav1.Time `json:"CreationTimestamp,omitempty"`
+	LastScheduleTime  *metav1.Time `json:"LastScheduleTime,omitempty"`
+}
+
+// LegacySpec is the spec of a ThirdPartyResource Policy.
+type LegacySpec struct {
+	api.PolicySpec
+	Status *LegacyStatus `json:"status,omitempty"`
+}
+
+// LegacyPolicy is a Policy as it was stored under the ThirdPartyResource.
+type LegacyPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              LegacySpec `json:"spec"`
+}
+
+// LegacyPolicyList is a list of legacy policies, it is also the format of
+// the migration file.
+type LegacyPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LegacyPolicy `json:"items"`
+}
+
+// Result is the outcome of migrating a single policy.
+type Result string
+
+const (
+	// Created means the policy did not exist and was created.
+	Created Result = "created"
+	// Updated means the policy existed and its status was carried over.
+	Updated Result = "updated"
+	// Skipped means the policy was left untouched.
+	Skipped Result = "skipped"
+)
+
+// Entry reports what happened to a single policy.
+type Entry struct {
+	Namespace string
+	Name      string
+	Result    Result
+	Reason    string
+}
+
+// String implements fmt.Stringer.
+func (e Entry) String() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("%s/%s: %s", e.Namespace, e.Name, e.Result)
+	}
+	return fmt.Sprintf("%s/%s: %s (%s)", e.Namespace, e.Name, e.Result, e.Reason)
+}
+
+// List reads the legacy policies of all namespaces through client, which is
+// the client returned by client.CreateRestClient.
+func List(client rest.Interface) (*LegacyPolicyList, error) {
+	raw, err := client.Get().Resource("policies").DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	list := &LegacyPolicyList{}
+	if err := json.Unmarshal(raw, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ReadFile reads legacy policies that were saved with WriteFile.
+func ReadFile(path string) (*LegacyPolicyList, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	list := &LegacyPolicyList{}
+	if err := json.Unmarshal(raw, list); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", path, err)
+	}
+	return list, nil
+}
+
+// WriteFile saves legacy policies so they can be imported into another
+// cluster, or into the same cluster once it serves the CRD.
+func WriteFile(path string, list *LegacyPolicyList) error {
+	raw, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, raw, 0600)
+}
+
+// Convert rewrites a legacy policy as a CRD Policy. Names, namespaces,
+// labels, annotations and the last run are kept; server populated metadata
+// is dropped.
+func Convert(in *LegacyPolicy) *api.Policy {
+	out := &api.Policy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: api.SchemeGroupVersion.String(),
+			Kind:       "Policy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        in.Name,
+			Namespace:   in.Namespace,
+			Labels:      in.Labels,
+			Annotations: in.Annotations,
+		},
+		Spec: in.Spec.PolicySpec,
+	}
+	if in.Spec.Status != nil && in.Spec.Status.LastScheduleTime != nil {
+		out.Status.LastScheduleTime = in.Spec.Status.LastScheduleTime.DeepCopy()
+	}
+	return out
+}
+
+// Import writes every legacy policy as a v1beta2 Policy through client. The
+// policies are converted here, so that the import does not depend on the
+// conversion webhook. Policies that already exist keep their spec; only a
+// missing last run is carried over. With dryRun nothing is written.
+func Import(client typed.PoliciesGetter, list *LegacyPolicyList, dryRun bool) ([]Entry, error) {
+	entries := []Entry{}
+	for i := range list.Items {
+		legacy := &list.Items[i]
+		entry := Entry{Namespace: legacy.Namespace, Name: legacy.Name}
+		if legacy.Name == "" || legacy.Namespace == "" {
+			entry.Result, entry.Reason = Skipped, "missing name or namespace"
+			entries = append(entries, entry)
+			continue
+		}
+
+		policy := &v1beta2.Policy{}
+		if err := Convert(legacy).ConvertTo(policy); err != nil {
+			return entries, fmt.Errorf("cannot convert %s/%s: %v", legacy.Namespace, legacy.Name, err)
+		}
+		entry.Result, entry.Reason = importOne(client.Policies(legacy.Namespace), policy, dryRun)
+		if entry.Result == "" {
+			return entries, fmt.Errorf("cannot migrate %s/%s: %s", legacy.Namespace, legacy.Name, entry.Reason)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func importOne(client typed.PolicyInterface, policy *v1beta2.Policy, dryRun bool) (Result, string) {
+	existing, err := client.Get(policy.Name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		if dryRun {
+			return Created, "dry run"
+		}
+		created, err := client.Create(policy)
+		if err != nil {
+			return "", err.Error()
+		}
+		if policy.Status.LastScheduleTime == nil {
+			return Created, ""
+		}
+		created.Status = policy.Status
+		if _, err := client.UpdateStatus(created); err != nil {
+			return "", fmt.Sprintf("created, but the last run was not recorded: %v", err)
+		}
+		return Created, "with last run"
+	case err != nil:
+		return "", err.Error()
+	}
+
+	if !equality.Semantic.DeepEqual(existing.Spec, policy.Spec) {
+		return Skipped, "exists with a different spec"
+	}
+	if policy.Status.LastScheduleTime == nil || existing.Status.LastScheduleTime != nil {
+		return Skipped, "already migrated"
+	}
+	if dryRun {
+		return Updated, "dry run"
+	}
+	existing.Status.LastScheduleTime = policy.Status.LastScheduleTime
+	if len(existing.Status.Rules) == 0 {
+		existing.Status.Rules = policy.Status.Rules
+	}
+	if _, err := client.UpdateStatus(existing); err != nil {
+		return "", err.Error()
+	}
+	return Updated, "last run"
+}
@@ -0,0 +1,178 @@
+// Package object reads and writes objects of any kind the apiserver serves,
+// found through discovery. The objects are handled as unstructured content,
+// so that fields the controller does not know about are kept. The namespace
+// passed along is ignored for cluster-scoped kinds.
+package object
+
+import (
+	"encoding/json"
+
+	autoscaling "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/hchenxa/timebase/pkg/apiresource"
+)
+
+// Interface reads and writes the objects references point at.
+type Interface interface {
+	Get(namespace string, ref autoscaling.CrossVersionObjectReference) (*unstructured.Unstructured, error)
+	// List returns the names of the objects of kind in namespace that match
+	// selector.
+	List(namespace, apiVersion, kind string, selector labels.Selector) ([]string, error)
+	// Update writes obj back, it must have been returned by Get.
+	Update(namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	Patch(namespace string, ref autoscaling.CrossVersionObjectReference, pt types.PatchType, data []byte) (*unstructured.Unstructured, error)
+	Create(namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	Delete(namespace string, ref autoscaling.CrossVersionObjectReference) error
+	// Namespaced reports whether the kind ref points at is namespaced.
+	Namespaced(ref autoscaling.CrossVersionObjectReference) (bool, error)
+}
+
+type client struct {
+	resolver *apiresource.Resolver
+	rest     rest.Interface
+}
+
+// New returns an object client that resolves references through the
+// discovery API of the apiserver of kubeClient.
+func New(kubeClient kubernetes.Interface) Interface {
+	return &client{
+		resolver: apiresource.NewResolver(kubeClient.Discovery(), nil, ""),
+		rest:     kubeClient.Discovery().RESTClient(),
+	}
+}
+
+// Ref returns the reference of obj.
+func Ref(obj *unstructured.Unstructured) autoscaling.CrossVersionObjectReference {
+	return autoscaling.CrossVersionObjectReference{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(), Name: obj.GetName()}
+}
+
+// Get returns the object ref points at in namespace.
+func (c *client) Get(namespace string, ref autoscaling.CrossVersionObjectReference) (*unstructured.Unstructured, error) {
+	return c.do(namespace, ref, func(p string) ([]byte, error) {
+		return c.rest.Get().AbsPath(p, ref.Name).DoRaw()
+	})
+}
+
+// List returns the names of the objects of kind in namespace that match
+// selector.
+func (c *client) List(namespace, apiVersion, kind string, selector labels.Selector) ([]string, error) {
+	r, err := c.resolver.Resolve(apiVersion, kind)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := c.rest.Get().AbsPath(r.Path(namespace)).Param("labelSelector", selector.String()).DoRaw()
+	if err != nil {
+		c.resolver.Forget(err)
+		return nil, err
+	}
+	list := struct {
+		Items []struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+		} `json:"items"`
+	}{}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		names = append(names, item.Metadata.Name)
+	}
+	return names, nil
+}
+
+// Update writes obj back to namespace.
+func (c *client) Update(namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	body, err := obj.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return c.do(namespace, Ref(obj), func(p string) ([]byte, error) {
+		return c.rest.Put().AbsPath(p, obj.GetName()).Body(body).DoRaw()
+	})
+}
+
+// Patch applies the patch data of type pt to the object ref points at in
+// namespace.
+func (c *client) Patch(namespace string, ref autoscaling.CrossVersionObjectReference, pt types.PatchType, data []byte) (*unstructured.Unstructured, error) {
+	return c.do(namespace, ref, func(p string) ([]byte, error) {
+		return c.rest.Patch(pt).AbsPath(p, ref.Name).Body(data).DoRaw()
+	})
+}
+
+// Create creates obj in namespace.
+func (c *client) Create(namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	body, err := obj.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return c.do(namespace, Ref(obj), func(p string) ([]byte, error) {
+		return c.rest.Post().AbsPath(p).Body(body).DoRaw()
+	})
+}
+
+// Delete deletes the object ref points at in namespace, letting the garbage
+// collector remove its dependents in the background.
+func (c *client) Delete(namespace string, ref autoscaling.CrossVersionObjectReference) error {
+	propagation := metav1.DeletePropagationBackground
+	body, err := json.Marshal(&metav1.DeleteOptions{
+		TypeMeta:          metav1.TypeMeta{APIVersion: "v1", Kind: "DeleteOptions"},
+		PropagationPolicy: &propagation,
+	})
+	if err != nil {
+		return err
+	}
+	r, err := c.resolver.Resolve(ref.APIVersion, ref.Kind)
+	if err != nil {
+		return err
+	}
+	if _, err := c.rest.Delete().AbsPath(r.Path(namespace), ref.Name).Body(body).DoRaw(); err != nil {
+		c.resolver.Forget(err)
+		return err
+	}
+	return nil
+}
+
+// Namespaced reports whether the kind ref points at is namespaced.
+func (c *client) Namespaced(ref autoscaling.CrossVersionObjectReference) (bool, error) {
+	r, err := c.resolver.Resolve(ref.APIVersion, ref.Kind)
+	return r.Namespaced, err
+}
+
+// do runs request against the path of the collection of the kind of ref in
+// namespace and decodes the object it returns.
+func (c *client) do(namespace string, ref autoscaling.CrossVersionObjectReference, request func(p string) ([]byte, error)) (*unstructured.Unstructured, error) {
+	r, err := c.resolver.Resolve(ref.APIVersion, ref.Kind)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := request(r.Path(namespace))
+	if err != nil {
+		c.resolver.Forget(err)
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// Field returns the value at fields in obj, the content of an unstructured
+// object or a part of it, or nil if there is none.
+func Field(obj map[string]interface{}, fields ...string) interface{} {
+	var v interface{} = obj
+	for _, f := range fields {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[f]
+	}
+	return v
+}
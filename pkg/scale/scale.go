@@ -0,0 +1,234 @@
+// Package scale reads and updates the scale subresource of any resource the
+// apiserver serves, such as Deployments, StatefulSets, ReplicationControllers
+// or custom resources that declare one. Resources are found through
+// discovery.
+package scale
+
+import (
+	"encoding/json"
+	"path"
+
+	autoscaling "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/hchenxa/timebase/pkg/apiresource"
+)
+
+// Scale is the scale of a resource as served by its scale subresource.
+type Scale struct {
+	Spec   ScaleSpec
+	Status ScaleStatus
+
+	// object is the subresource as served, it is sent back on update so
+	// that fields the controller does not know about are kept.
+	object *unstructured.Unstructured
+}
+
+// ScaleSpec is the requested scale of a resource.
+type ScaleSpec struct {
+	Replicas int32
+}
+
+// ScaleStatus is the observed scale of a resource.
+type ScaleStatus struct {
+	Replicas int32
+	// Selector selects the pods of the resource, in the string form of
+	// label selectors. It is empty when the resource does not report one.
+	Selector string
+}
+
+// Interface reads and updates the scale of the object a reference points at.
+type Interface interface {
+	Get(namespace string, ref autoscaling.CrossVersionObjectReference) (*Scale, error)
+	Update(namespace string, ref autoscaling.CrossVersionObjectReference, scale *Scale) (*Scale, error)
+	// ListAll returns every scalable object in namespace that no other
+	// object controls.
+	ListAll(namespace string) ([]Workload, error)
+}
+
+// Workload is a scalable object found by ListAll.
+type Workload struct {
+	autoscaling.CrossVersionObjectReference
+	// Replicas is the requested scale of the object as listed, or nil when
+	// it does not keep it in spec.replicas and only its scale subresource
+	// tells.
+	Replicas *int32
+}
+
+type client struct {
+	resolver *apiresource.Resolver
+	rest     rest.Interface
+}
+
+// New returns a scale client that resolves references through the discovery
+// API of the apiserver of kubeClient.
+func New(kubeClient kubernetes.Interface) Interface {
+	return &client{
+		resolver: apiresource.NewResolver(kubeClient.Discovery(), scalable, "with a scale subresource"),
+		rest:     kubeClient.Discovery().RESTClient(),
+	}
+}
+
+// scalable reports whether r is a namespaced resource with a scale
+// subresource.
+func scalable(r apiresource.Resource) bool {
+	return r.Namespaced && r.HasSubresource("scale")
+}
+
+// Get returns the scale of the object ref points at in namespace.
+func (c *client) Get(namespace string, ref autoscaling.CrossVersionObjectReference) (*Scale, error) {
+	p, err := c.path(namespace, ref)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := c.rest.Get().AbsPath(p).DoRaw()
+	if err != nil {
+		c.resolver.Forget(err)
+		return nil, err
+	}
+	return decode(raw)
+}
+
+// Update sets the scale of the object ref points at in namespace to the
+// requested replicas of scale, which must have been returned by Get.
+func (c *client) Update(namespace string, ref autoscaling.CrossVersionObjectReference, scale *Scale) (*Scale, error) {
+	p, err := c.path(namespace, ref)
+	if err != nil {
+		return nil, err
+	}
+	obj := scale.object.DeepCopy()
+	spec, _ := obj.Object["spec"].(map[string]interface{})
+	if spec == nil {
+		spec = map[string]interface{}{}
+		obj.Object["spec"] = spec
+	}
+	spec["replicas"] = int64(scale.Spec.Replicas)
+	body, err := obj.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := c.rest.Put().AbsPath(p).Body(body).DoRaw()
+	if err != nil {
+		c.resolver.Forget(err)
+		return nil, err
+	}
+	return decode(raw)
+}
+
+// ListAll returns every scalable object in namespace that no other object
+// controls, such as the ReplicaSets of a Deployment, which follow the scale
+// of their owner. A kind served by several groups, such as Deployments in
+// apps and extensions, is listed once.
+func (c *client) ListAll(namespace string) ([]Workload, error) {
+	resources, err := c.resolver.Preferred()
+	if err != nil {
+		return nil, err
+	}
+	workloads := []Workload{}
+	seen := map[string]bool{}
+	for _, r := range resources {
+		if seen[r.Kind] {
+			continue
+		}
+		seen[r.Kind] = true
+		items, err := c.list(r, namespace, labels.Everything())
+		if err != nil {
+			c.resolver.Forget(err)
+			return nil, err
+		}
+		for _, item := range items {
+			if metav1.GetControllerOf(&item.Metadata) != nil {
+				continue
+			}
+			workloads = append(workloads, Workload{
+				CrossVersionObjectReference: autoscaling.CrossVersionObjectReference{APIVersion: r.GroupVersion.String(), Kind: r.Kind, Name: item.Metadata.Name},
+				Replicas:                    item.Spec.Replicas,
+			})
+		}
+	}
+	return workloads, nil
+}
+
+// item is the part of a listed object the client reads.
+type item struct {
+	Metadata metav1.ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Replicas *int32 `json:"replicas"`
+	} `json:"spec"`
+}
+
+// list returns the objects of r in namespace that match selector.
+func (c *client) list(r apiresource.Resource, namespace string, selector labels.Selector) ([]item, error) {
+	raw, err := c.rest.Get().AbsPath(r.Path(namespace)).Param("labelSelector", selector.String()).DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	list := struct {
+		Items []item `json:"items"`
+	}{}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// path returns the path of the scale subresource of ref in namespace.
+func (c *client) path(namespace string, ref autoscaling.CrossVersionObjectReference) (string, error) {
+	r, err := c.resolver.Resolve(ref.APIVersion, ref.Kind)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(r.Path(namespace), ref.Name, "scale"), nil
+}
+
+func decode(raw []byte) (*Scale, error) {
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	return &Scale{
+		Spec:   ScaleSpec{Replicas: replicas(obj, "spec")},
+		Status: ScaleStatus{Replicas: replicas(obj, "status"), Selector: selector(obj)},
+		object: obj,
+	}, nil
+}
+
+// replicas returns the replicas of the spec or status of a scale.
+func replicas(obj *unstructured.Unstructured, field string) int32 {
+	m, _ := obj.Object[field].(map[string]interface{})
+	switch n := m["replicas"].(type) {
+	case int64:
+		return int32(n)
+	case float64:
+		return int32(n)
+	}
+	return 0
+}
+
+// selector returns the pod selector of the status of a scale. The
+// autoscaling/v1 scale serves it as a string, the extensions/v1beta1 one as
+// targetSelector, or as a map when its resource only has matchLabels.
+func selector(obj *unstructured.Unstructured) string {
+	m, _ := obj.Object["status"].(map[string]interface{})
+	for _, field := range []string{"selector", "targetSelector"} {
+		if s, ok := m[field].(string); ok && s != "" {
+			return s
+		}
+	}
+	set := labels.Set{}
+	if s, ok := m["selector"].(map[string]interface{}); ok {
+		for k, v := range s {
+			if v, ok := v.(string); ok {
+				set[k] = v
+			}
+		}
+	}
+	if len(set) == 0 {
+		return ""
+	}
+	return set.String()
+}
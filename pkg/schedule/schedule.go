@@ -0,0 +1,105 @@
+// Package schedule evaluates cron schedules in a time zone, with a defined
+// behavior across daylight saving transitions.
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// zonedSchedule evaluates a cron schedule against the wall clock of a time
+// zone. The cron expression is matched against local wall times, which are
+// then mapped to instants with a defined daylight saving behavior:
+//
+//   - A wall time skipped when the clocks go forward runs at the first
+//     instant after the gap, e.g. 02:30 on a 02:00 -> 03:00 day runs at 03:00.
+//   - A wall time repeated when the clocks go back runs once, at its first
+//     occurrence; the repeated hour does not fire again.
+//
+// So a schedule never runs twice for the same wall time and never loses one.
+type zonedSchedule struct {
+	sched cron.Schedule
+	loc   *time.Location
+}
+
+// Parse parses a standard cron expression evaluated in the named IANA time
+// zone, or in the local time zone of the controller when timeZone is empty.
+func Parse(schedule, timeZone string) (cron.Schedule, error) {
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("Unparseable schedule: %s : %s", schedule, err)
+	}
+	loc := time.Local
+	if timeZone != "" {
+		if loc, err = time.LoadLocation(timeZone); err != nil {
+			return nil, fmt.Errorf("Unknown time zone: %s : %s", timeZone, err)
+		}
+	}
+	return &zonedSchedule{sched: sched, loc: loc}, nil
+}
+
+// Next returns the first activation strictly after t, or the zero time if
+// the schedule never matches, like the schedules of the cron package.
+func (z *zonedSchedule) Next(t time.Time) time.Time {
+	wall := toWall(t.In(z.loc))
+	// When t lies in the second pass of a repeated hour, the wall times
+	// after it first occurred in the first pass, before t; they are stepped
+	// over until one first occurs after t. Wall times only ever increase,
+	// so this ends at the latest once the repeated hour is over.
+	for {
+		wall = z.sched.Next(wall)
+		if wall.IsZero() {
+			return time.Time{}
+		}
+		if first, _ := z.instants(wall); first.After(t) {
+			return first
+		}
+	}
+}
+
+// toWall returns the wall clock of t as a UTC time, which has no daylight
+// saving transitions.
+func toWall(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// instants maps a wall clock time to the first and last instant it occurs
+// at in z.loc. They differ when the wall time is repeated; when it is
+// skipped both are the end of the gap.
+func (z *zonedSchedule) instants(wall time.Time) (time.Time, time.Time) {
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), z.loc)
+	switch w := toWall(t); {
+	case w.After(wall):
+		// Skipped: t was moved past the gap, which starts its zone.
+		start, _ := t.ZoneBounds()
+		return start, start
+	case w.Before(wall):
+		// Skipped: t was interpreted in the zone before the gap.
+		_, end := t.ZoneBounds()
+		return end, end
+	}
+
+	// The wall time may also exist in the zone just before or after the
+	// one t was placed in.
+	first, last := t, t
+	start, end := t.ZoneBounds()
+	if !start.IsZero() {
+		if alt := atOffset(wall, start.Add(-time.Nanosecond)); alt.Before(start) && toWall(alt.In(z.loc)).Equal(wall) {
+			first = alt
+		}
+	}
+	if !end.IsZero() {
+		if alt := atOffset(wall, end); !alt.Before(end) && toWall(alt.In(z.loc)).Equal(wall) {
+			last = alt
+		}
+	}
+	return first, last
+}
+
+// atOffset interprets wall in the UTC offset in effect at ref.
+func atOffset(wall, ref time.Time) time.Time {
+	_, offset := ref.Zone()
+	return wall.Add(-time.Duration(offset) * time.Second)
+}
@@ -0,0 +1,75 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// In America/New_York the clocks went forward from 02:00 to 03:00 on
+// 2021-03-14, and back from 02:00 to 01:00 on 2021-11-07.
+const newYork = "America/New_York"
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func zoned(t *testing.T, schedule string) *zonedSchedule {
+	sched, err := Parse(schedule, newYork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sched.(*zonedSchedule)
+}
+
+func TestInstants(t *testing.T) {
+	tests := []struct {
+		name        string
+		wall        string
+		first, last string
+	}{
+		{"plain", "2021-06-01T09:00:00Z", "2021-06-01T13:00:00Z", "2021-06-01T13:00:00Z"},
+		{"gap runs at its end", "2021-03-14T02:30:00Z", "2021-03-14T07:00:00Z", "2021-03-14T07:00:00Z"},
+		{"start of gap", "2021-03-14T02:00:00Z", "2021-03-14T07:00:00Z", "2021-03-14T07:00:00Z"},
+		{"end of gap", "2021-03-14T03:00:00Z", "2021-03-14T07:00:00Z", "2021-03-14T07:00:00Z"},
+		{"overlap occurs twice", "2021-11-07T01:30:00Z", "2021-11-07T05:30:00Z", "2021-11-07T06:30:00Z"},
+		{"after overlap", "2021-11-07T02:00:00Z", "2021-11-07T07:00:00Z", "2021-11-07T07:00:00Z"},
+	}
+	z := zoned(t, "* * * * *")
+	for _, tt := range tests {
+		first, last := z.instants(utc(tt.wall))
+		if !first.Equal(utc(tt.first)) || !last.Equal(utc(tt.last)) {
+			t.Errorf("%s: instants(%s) = %s, %s, want %s, %s", tt.name, tt.wall, first.UTC(), last.UTC(), tt.first, tt.last)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		after    string
+		want     string
+	}{
+		{"plain", "0 9 * * 1-5", "2021-06-04T14:00:00Z", "2021-06-07T13:00:00Z"},
+		{"skipped wall time runs after the gap", "30 2 * * *", "2021-03-14T05:00:00Z", "2021-03-14T07:00:00Z"},
+		{"day after the gap", "30 2 * * *", "2021-03-14T07:00:00Z", "2021-03-15T06:30:00Z"},
+		{"repeated wall time runs at its first pass", "30 1 * * *", "2021-11-07T04:00:00Z", "2021-11-07T05:30:00Z"},
+		{"repeated wall time does not run again", "30 1 * * *", "2021-11-07T05:30:00Z", "2021-11-08T06:30:00Z"},
+		{"second pass of the repeated hour is stepped over", "* * * * *", "2021-11-07T06:30:00Z", "2021-11-07T07:00:00Z"},
+		{"every minute before the overlap", "* * * * *", "2021-11-07T05:58:30Z", "2021-11-07T05:59:00Z"},
+		{"never matches", "0 0 30 2 *", "2021-01-01T00:00:00Z", ""},
+	}
+	for _, tt := range tests {
+		got := zoned(t, tt.schedule).Next(utc(tt.after))
+		switch {
+		case tt.want == "" && !got.IsZero():
+			t.Errorf("%s: Next(%s) = %s, want the zero time", tt.name, tt.after, got.UTC())
+		case tt.want != "" && !got.Equal(utc(tt.want)):
+			t.Errorf("%s: Next(%s) = %s, want %s", tt.name, tt.after, got.UTC(), tt.want)
+		}
+	}
+}
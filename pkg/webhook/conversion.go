@@ -0,0 +1,145 @@
+// Package webhook serves the conversion webhook of the Policy
+// CustomResourceDefinition.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1"
+	"github.com/hchenxa/timebase/pkg/api/icp.ibm.com/v1beta2"
+)
+
+// ConversionReview mirrors the apiextensions.k8s.io/v1 ConversionReview the
+// apiserver sends to the webhook.
+type ConversionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *ConversionRequest  `json:"request,omitempty"`
+	Response        *ConversionResponse `json:"response,omitempty"`
+}
+
+// ConversionRequest holds the objects to convert and the version to convert them to.
+type ConversionRequest struct {
+	UID               types.UID         `json:"uid"`
+	DesiredAPIVersion string            `json:"desiredAPIVersion"`
+	Objects           []json.RawMessage `json:"objects"`
+}
+
+// ConversionResponse holds the converted objects in the order of the request.
+type ConversionResponse struct {
+	UID              types.UID         `json:"uid"`
+	ConvertedObjects []json.RawMessage `json:"convertedObjects"`
+	Result           metav1.Status     `json:"result"`
+}
+
+// Spoke is a version of Policy that converts through the hub version.
+type Spoke interface {
+	ConvertTo(hub *v1beta2.Policy) error
+	ConvertFrom(hub *v1beta2.Policy) error
+}
+
+// spokes builds an empty policy of every version that is not the hub.
+var spokes = map[string]func() Spoke{
+	v1.SchemeGroupVersion.String(): func() Spoke { return &v1.Policy{} },
+}
+
+// Convert converts a single serialized policy to the desired version,
+// going through the hub version.
+func Convert(raw []byte, desiredAPIVersion string) ([]byte, error) {
+	meta := metav1.TypeMeta{}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, err
+	}
+	if meta.APIVersion == desiredAPIVersion {
+		return raw, nil
+	}
+
+	hub := &v1beta2.Policy{}
+	if meta.APIVersion == v1beta2.SchemeGroupVersion.String() {
+		if err := json.Unmarshal(raw, hub); err != nil {
+			return nil, err
+		}
+	} else {
+		newSpoke, ok := spokes[meta.APIVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported apiVersion %q", meta.APIVersion)
+		}
+		spoke := newSpoke()
+		if err := json.Unmarshal(raw, spoke); err != nil {
+			return nil, err
+		}
+		if err := spoke.ConvertTo(hub); err != nil {
+			return nil, err
+		}
+	}
+
+	if desiredAPIVersion == v1beta2.SchemeGroupVersion.String() {
+		return json.Marshal(hub)
+	}
+	newSpoke, ok := spokes[desiredAPIVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported apiVersion %q", desiredAPIVersion)
+	}
+	spoke := newSpoke()
+	if err := spoke.ConvertFrom(hub); err != nil {
+		return nil, err
+	}
+	return json.Marshal(spoke)
+}
+
+func review(request *ConversionRequest) *ConversionResponse {
+	response := &ConversionResponse{
+		UID:    request.UID,
+		Result: metav1.Status{Status: metav1.StatusSuccess},
+	}
+	for _, raw := range request.Objects {
+		converted, err := Convert(raw, request.DesiredAPIVersion)
+		if err != nil {
+			response.ConvertedObjects = nil
+			response.Result = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+			return response
+		}
+		response.ConvertedObjects = append(response.ConvertedObjects, converted)
+	}
+	return response
+}
+
+// ServeConversion handles a ConversionReview.
+func ServeConversion(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in := &ConversionReview{}
+	if err := json.Unmarshal(body, in); err != nil || in.Request == nil {
+		http.Error(w, fmt.Sprintf("invalid ConversionReview: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	out := &ConversionReview{TypeMeta: in.TypeMeta, Response: review(in.Request)}
+	if out.Response.Result.Status == metav1.StatusFailure {
+		log.Printf("Conversion %s to %s failed: %s", in.Request.UID, in.Request.DesiredAPIVersion, out.Response.Result.Message)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		log.Printf("Cannot write ConversionReview response: %v", err)
+	}
+}
+
+// Serve serves the conversion webhook on addr over TLS until it fails.
+func Serve(addr, certFile, keyFile string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/convert", ServeConversion)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	log.Printf("Serving the conversion webhook on %s", addr)
+	return http.ListenAndServeTLS(addr, certFile, keyFile, mux)
+}
@@ -0,0 +1,29 @@
+// Package resources holds the manifests shipped with the controller. The
+// CustomResourceDefinitions are generated from the templates in crd and the
+// API types, run go generate after changing either.
+package resources
+
+//go:generate go run ../hack/crdgen -types ../pkg/api/icp.ibm.com -templates crd -out .
+
+import (
+	// Needed for go:embed.
+	_ "embed"
+)
+
+// PolicyCRD is the CustomResourceDefinition of the Policy resource, it is
+// installed or upgraded by the controller at startup.
+//
+//go:embed policy-crd.yaml
+var PolicyCRD []byte
+
+// ClusterPolicyCRD is the CustomResourceDefinition of the ClusterPolicy
+// resource. It has a single version and needs no conversion webhook.
+//
+//go:embed clusterpolicy-crd.yaml
+var ClusterPolicyCRD []byte
+
+// HibernationCRD is the CustomResourceDefinition of the Hibernation
+// resource.
+//
+//go:embed hibernation-crd.yaml
+var HibernationCRD []byte